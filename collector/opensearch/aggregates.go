@@ -0,0 +1,395 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// snapshot is the result of one scrape: the parsed shards plus aggregates
+// computed from them. It is built once per CollectMetrics call and read by
+// the observable callbacks on every export.
+type snapshot struct {
+	samples []shardSample
+	indices map[string]*indexAggregate
+	nodes   map[string]*nodeAggregate
+	pending map[shardKey]pendingShard
+
+	unassigned map[unassignedKey]int64
+	byRole     map[roleKey]int64
+	relocating map[relocationKey]int64
+}
+
+// relocationKey groups relocating shards by index and the nodes they move
+// between.
+type relocationKey struct {
+	index  string
+	source string
+	target string
+}
+
+// roleKey groups shards by index, role and state for
+// opensearch.index.shards.by_role.
+type roleKey struct {
+	index  string
+	prirep string
+	state  string
+}
+
+// unassignedKey groups unassigned shards by index and unassigned reason.
+type unassignedKey struct {
+	index  string
+	reason string
+}
+
+// unknownReason stands in for unassigned shards that report no reason.
+const unknownReason = "UNKNOWN"
+
+// indexAggregate summarises the shards of one index. Desired counts include
+// every shard copy OpenSearch lists, active counts only those that are
+// STARTED or RELOCATING, so unassigned replicas show up as a gap between the
+// two. noStore counts shards that reported no store size at all, and
+// notStarted those in any state but STARTED. The live document count needs
+// Config.DocsStats; hasDeleted marks a deleted count taken from the
+// docs.deleted column or the _stats fallback.
+type indexAggregate struct {
+	primaries       int64
+	activePrimaries int64
+	replicas        int64
+	activeReplicas  int64
+	noStore         int64
+	notStarted      int64
+
+	docs         int64
+	docsDeleted  int64
+	hasDocsStats bool
+	hasDeleted   bool
+
+	// primaryStoreBytes sums the primaries only, totalStoreBytes every copy.
+	primaryStoreBytes float64
+	totalStoreBytes   float64
+}
+
+// unassignedNode groups shards that are not allocated to any node.
+const unassignedNode = "_unassigned"
+
+// nodeAggregate summarises the shards held by one node.
+type nodeAggregate struct {
+	shards     int64
+	storeBytes float64
+}
+
+// newSnapshot aggregates samples. previous is the snapshot of the last
+// successful scrape, which carries state between scrapes.
+func newSnapshot(samples []shardSample, previous snapshot, now time.Time) snapshot {
+	snap := snapshot{
+		samples: samples,
+		indices: make(map[string]*indexAggregate),
+		nodes:   make(map[string]*nodeAggregate),
+		pending: trackPending(previous.pending, samples, now),
+
+		unassigned: make(map[unassignedKey]int64),
+		byRole:     make(map[roleKey]int64),
+		relocating: make(map[relocationKey]int64),
+	}
+
+	for _, sample := range samples {
+		index, ok := snap.indices[sample.Index]
+		if !ok {
+			index = &indexAggregate{}
+			snap.indices[sample.Index] = index
+		}
+
+		active := isActive(sample.State)
+		if sample.State != "STARTED" {
+			index.notStarted++
+		}
+		switch sample.Prirep {
+		case "p":
+			index.primaries++
+			if active {
+				index.activePrimaries++
+			}
+		case "r":
+			index.replicas++
+			if active {
+				index.activeReplicas++
+			}
+		}
+		if sample.hasStore {
+			index.totalStoreBytes += sample.storeBytes
+			if sample.Prirep == "p" {
+				index.primaryStoreBytes += sample.storeBytes
+			}
+		} else {
+			index.noStore++
+		}
+		if sample.hasDeleted && sample.Prirep == "p" {
+			index.docsDeleted += sample.docsDeleted
+			index.hasDeleted = true
+		}
+		snap.byRole[roleKey{index: sample.Index, prirep: sample.Prirep, state: sample.State}]++
+		if sample.State == "UNASSIGNED" {
+			reason := sample.UnassignedReason
+			if reason == "" {
+				reason = unknownReason
+			}
+			snap.unassigned[unassignedKey{index: sample.Index, reason: reason}]++
+		}
+		if sample.relocationTarget != "" {
+			snap.relocating[relocationKey{index: sample.Index, source: sample.Node, target: sample.relocationTarget}]++
+		}
+
+		nodeName := sample.Node
+		if nodeName == "" {
+			nodeName = unassignedNode
+		}
+		node, ok := snap.nodes[nodeName]
+		if !ok {
+			node = &nodeAggregate{}
+			snap.nodes[nodeName] = node
+		}
+		node.shards++
+		if sample.hasStore {
+			node.storeBytes += sample.storeBytes
+		}
+	}
+
+	return snap
+}
+
+func isActive(state string) bool {
+	return state == "STARTED" || state == "RELOCATING"
+}
+
+func (c *ShardCollector) registerAggregateInstruments() error {
+	primaryCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.primary.count",
+		metric.WithDescription("Number of primary shards per index, desired and active"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create primary count gauge: %w", err)
+	}
+
+	replicaCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.replica.count",
+		metric.WithDescription("Number of replica shards per index, desired and active"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create replica count gauge: %w", err)
+	}
+
+	primaryStoreSize, err := c.meter.Float64ObservableGauge(
+		"opensearch.index.primary.store.size",
+		metric.WithDescription("Store size of the primary shards of each index"),
+		metric.WithUnit(string(c.cfg.StoreUnit)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create primary store size gauge: %w", err)
+	}
+
+	totalStoreSize, err := c.meter.Float64ObservableGauge(
+		"opensearch.index.total.store.size",
+		metric.WithDescription("Store size of all primary and replica shards of each index"),
+		metric.WithUnit(string(c.cfg.StoreUnit)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create total store size gauge: %w", err)
+	}
+
+	nodeShardCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.node.shard.count",
+		metric.WithDescription("Number of shards held by each node"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create node shard count gauge: %w", err)
+	}
+
+	nodeStoreSize, err := c.meter.Float64ObservableGauge(
+		"opensearch.node.store.size",
+		metric.WithDescription("Total store size of the shards held by each node"),
+		metric.WithUnit(string(c.cfg.StoreUnit)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create node store size gauge: %w", err)
+	}
+
+	nodeImbalance, err := c.meter.Float64ObservableGauge(
+		"opensearch.node.shard.imbalance",
+		metric.WithDescription("Shards held by each node relative to the average across nodes; 1 is perfectly balanced. Unassigned shards are excluded"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create node shard imbalance gauge: %w", err)
+	}
+
+	noStoreCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.shards.no_store.count",
+		metric.WithDescription("Number of shards per index that report no store size, such as unassigned shards"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create no store count gauge: %w", err)
+	}
+
+	unassignedCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.shards.unassigned",
+		metric.WithDescription("Number of unassigned shards per index, by unassigned reason"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create unassigned shards gauge: %w", err)
+	}
+
+	relocatingCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.shards.relocating",
+		metric.WithDescription("Number of relocating shards per index, by source and target node"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create relocating shards gauge: %w", err)
+	}
+
+	shardsTotal, err := c.meter.Int64ObservableGauge(
+		"opensearch.shards.total",
+		metric.WithDescription("Number of shards observed in the last scrape"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create total shards gauge: %w", err)
+	}
+
+	indicesTotal, err := c.meter.Int64ObservableGauge(
+		"opensearch.indices.total",
+		metric.WithDescription("Number of distinct indices observed in the last scrape"),
+		metric.WithUnit("{indices}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create total indices gauge: %w", err)
+	}
+
+	fullyAllocated, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.fully_allocated",
+		metric.WithDescription("Whether every shard copy of the index is STARTED: 1 if so, 0 while any is unassigned, initializing or relocating"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create fully allocated gauge: %w", err)
+	}
+
+	docsCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.docs.count",
+		metric.WithDescription("Number of live documents in the primary shards of each index"),
+		metric.WithUnit("{documents}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create index docs count gauge: %w", err)
+	}
+
+	docsDeleted, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.docs.deleted",
+		metric.WithDescription("Number of deleted documents not yet merged away in the primary shards of each index"),
+		metric.WithUnit("{documents}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create index docs deleted gauge: %w", err)
+	}
+
+	shardsByRole, err := c.meter.Int64ObservableGauge(
+		"opensearch.index.shards.by_role",
+		metric.WithDescription("Number of shards per index by role (prirep) and state"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create shards by role gauge: %w", err)
+	}
+
+	desired := attribute.String("status", "desired")
+	active := attribute.String("status", "active")
+
+	_, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		snap := c.snapshot
+		c.mu.RUnlock()
+
+		// Totals are only meaningful once a scrape has succeeded.
+		if snap.indices != nil {
+			o.ObserveInt64(shardsTotal, int64(len(snap.samples)))
+			o.ObserveInt64(indicesTotal, int64(len(snap.indices)))
+		}
+
+		for name, index := range snap.indices {
+			indexAttr := attribute.String("index", name)
+
+			o.ObserveInt64(primaryCount, index.primaries, metric.WithAttributes(indexAttr, desired))
+			o.ObserveInt64(primaryCount, index.activePrimaries, metric.WithAttributes(indexAttr, active))
+			o.ObserveInt64(replicaCount, index.replicas, metric.WithAttributes(indexAttr, desired))
+			o.ObserveInt64(replicaCount, index.activeReplicas, metric.WithAttributes(indexAttr, active))
+			o.ObserveInt64(noStoreCount, index.noStore, metric.WithAttributes(indexAttr))
+			var allocated int64
+			if index.notStarted == 0 {
+				allocated = 1
+			}
+			o.ObserveInt64(fullyAllocated, allocated, metric.WithAttributes(indexAttr))
+			if index.hasDocsStats {
+				o.ObserveInt64(docsCount, index.docs, metric.WithAttributes(indexAttr))
+			}
+			if index.hasDocsStats || index.hasDeleted {
+				o.ObserveInt64(docsDeleted, index.docsDeleted, metric.WithAttributes(indexAttr))
+			}
+			o.ObserveFloat64(primaryStoreSize, c.storeValue(index.primaryStoreBytes), metric.WithAttributes(indexAttr))
+			o.ObserveFloat64(totalStoreSize, c.storeValue(index.totalStoreBytes), metric.WithAttributes(indexAttr))
+		}
+		for key, count := range snap.unassigned {
+			o.ObserveInt64(unassignedCount, count, metric.WithAttributes(
+				attribute.String("index", key.index),
+				attribute.String("reason", key.reason),
+			))
+		}
+		for key, count := range snap.relocating {
+			o.ObserveInt64(relocatingCount, count, metric.WithAttributes(
+				attribute.String("index", key.index),
+				attribute.String("source_node", key.source),
+				attribute.String("target_node", key.target),
+			))
+		}
+		if c.cfg.ShardsByRole {
+			for key, count := range snap.byRole {
+				o.ObserveInt64(shardsByRole, count, metric.WithAttributes(
+					attribute.String("index", key.index),
+					attribute.String("prirep", key.prirep),
+					attribute.String("state", key.state),
+				))
+			}
+		}
+		var assignedNodes, assignedShards int64
+		for name, node := range snap.nodes {
+			if name != unassignedNode {
+				assignedNodes++
+				assignedShards += node.shards
+			}
+		}
+		for name, node := range snap.nodes {
+			attrs := metric.WithAttributes(attribute.String("node", name))
+
+			o.ObserveInt64(nodeShardCount, node.shards, attrs)
+			o.ObserveFloat64(nodeStoreSize, c.storeValue(node.storeBytes), attrs)
+			if name != unassignedNode && assignedShards > 0 {
+				average := float64(assignedShards) / float64(assignedNodes)
+				o.ObserveFloat64(nodeImbalance, float64(node.shards)/average, attrs)
+			}
+		}
+		return nil
+	}, shardsTotal, indicesTotal, primaryCount, replicaCount, noStoreCount, fullyAllocated, docsCount, docsDeleted, unassignedCount, relocatingCount, shardsByRole, primaryStoreSize, totalStoreSize, nodeShardCount, nodeStoreSize, nodeImbalance)
+	if err != nil {
+		return fmt.Errorf("failed to register aggregate callback: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// aliasResolver resolves Config.Aliases to the indices they point to. The
+// result is cached for Config.AliasRefreshInterval, so a rollover is picked
+// up on the first scrape after the cache expires.
+type aliasResolver struct {
+	aliases []string
+	refresh time.Duration
+	clock   Clock
+	logger  *slog.Logger
+
+	mu         sync.Mutex
+	indices    []string
+	resolvedAt time.Time
+}
+
+func newAliasResolver(cfg Config) *aliasResolver {
+	return &aliasResolver{aliases: cfg.Aliases, refresh: cfg.AliasRefreshInterval, clock: cfg.Clock, logger: cfg.Logger}
+}
+
+// resolve returns the indices behind the aliases, in sorted order. When a
+// refresh fails the previous resolution is kept and the refresh is retried
+// on the next call; only the first resolution can fail.
+func (r *aliasResolver) resolve(ctx context.Context, client *client) ([]string, error) {
+	if len(r.aliases) == 0 {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	if !r.resolvedAt.IsZero() && now.Sub(r.resolvedAt) < r.refresh {
+		return r.indices, nil
+	}
+	indices, err := r.fetch(ctx, client)
+	if err != nil {
+		if r.resolvedAt.IsZero() {
+			return nil, err
+		}
+		r.logger.Warn("Failed to refresh aliases, keeping the previous indices", "error", err)
+		return r.indices, nil
+	}
+	r.indices, r.resolvedAt = indices, now
+	return indices, nil
+}
+
+// targets returns the indices and patterns to scrape: indices plus the
+// indices the aliases currently resolve to. ok is false when aliases are
+// configured but nothing is left to scrape, as an empty target would select
+// every index.
+func (r *aliasResolver) targets(ctx context.Context, client *client, indices []string) (targets []string, ok bool, err error) {
+	if len(r.aliases) == 0 {
+		return indices, true, nil
+	}
+	resolved, err := r.resolve(ctx, client)
+	if err != nil {
+		return nil, false, err
+	}
+	targets = append(slices.Clip(indices), resolved...)
+	return targets, len(targets) > 0, nil
+}
+
+// fetch looks up each alias in turn, so one that doesn't exist doesn't hide
+// the indices of the others.
+func (r *aliasResolver) fetch(ctx context.Context, client *client) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, alias := range r.aliases {
+		// The response is keyed by the indices the alias points to.
+		var resp map[string]json.RawMessage
+		err := client.getJSON(ctx, "_alias/"+alias, "", &resp)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("failed to resolve alias %q: %w", alias, err)
+		}
+		if len(resp) == 0 {
+			r.logger.Warn("Alias resolves to no indices", "alias", alias)
+		}
+		for index := range resp {
+			seen[index] = true
+		}
+	}
+
+	indices := make([]string, 0, len(seen))
+	for index := range seen {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// contains reports whether index was resolved from an alias.
+func (r *aliasResolver) contains(index string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.SearchStrings(r.indices, index)
+	return i < len(r.indices) && r.indices[i] == index
+}
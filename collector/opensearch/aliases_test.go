@@ -0,0 +1,153 @@
+package opensearch_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"instrumentation/collector/opensearch"
+	"instrumentation/collector/opensearch/opensearchtest"
+)
+
+// lastRequest returns the last request srv received whose path starts with
+// prefix, or "" if there was none.
+func lastRequest(srv *opensearchtest.Server, prefix string) string {
+	requests := srv.Requests()
+	for i := len(requests) - 1; i >= 0; i-- {
+		path, _, _ := strings.Cut(requests[i], "?")
+		if strings.HasPrefix(path, prefix) {
+			return path
+		}
+	}
+	return ""
+}
+
+func TestShardCollectorFollowsAliasRollover(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	for _, index := range []string{"logs-000001", "logs-000002"} {
+		srv.SetShards(index, opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", Node: "node-1"})
+	}
+	srv.SetAlias("logs", "logs-000001")
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+	c, _ := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{Aliases: []string{"logs"}, AliasRefreshInterval: 5 * time.Minute}),
+		opensearch.WithClock(clock),
+	)
+
+	scrape := func(step, want string) {
+		t.Helper()
+		shards, err := c.CollectOnce(context.Background())
+		if err != nil {
+			t.Fatalf("%s: CollectOnce: %v", step, err)
+		}
+		var indices []string
+		for _, shard := range shards {
+			indices = append(indices, shard.Index)
+		}
+		if got := strings.Join(indices, ","); got != want {
+			t.Errorf("%s: scraped %q, want %q", step, got, want)
+		}
+	}
+
+	scrape("first scrape", "logs-000001")
+
+	// The resolution is cached until the refresh interval has passed.
+	srv.SetAlias("logs", "logs-000002")
+	clock.Advance(time.Minute)
+	scrape("within the refresh interval", "logs-000001")
+	clock.Advance(4 * time.Minute)
+	scrape("after the refresh interval", "logs-000002")
+
+	// A failed refresh keeps the previous indices.
+	srv.SetResponse("/_alias/logs", http.StatusInternalServerError, `{"error":"boom"}`)
+	clock.Advance(5 * time.Minute)
+	scrape("failed refresh", "logs-000002")
+}
+
+func TestIndexRateCollectorResolvesAliases(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	setTotals := func(index string, indexed, queries int) {
+		srv.SetResponse("/"+index+"/_stats/indexing,search", http.StatusOK, fmt.Sprintf(
+			`{"indices":{%q:{"total":{"indexing":{"index_total":%d},"search":{"query_total":%d}}}}}`,
+			index, indexed, queries))
+	}
+	srv.SetAlias("logs", "logs-000001")
+	setTotals("logs-000001", 100, 10)
+	setTotals("logs-000002", 0, 0)
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	c, err := opensearch.NewIndexRateCollector(srv.URL, provider, opensearch.Config{
+		Aliases:              []string{"logs"},
+		AliasRefreshInterval: 5 * time.Minute,
+		Clock:                clock,
+	})
+	if err != nil {
+		t.Fatalf("NewIndexRateCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	collectRates := func(step, wantPath string) map[string]float64 {
+		t.Helper()
+		if err := c.CollectMetrics(context.Background()); err != nil {
+			t.Fatalf("%s: CollectMetrics: %v", step, err)
+		}
+		if got := lastRequest(srv, "/logs-"); got != wantPath {
+			t.Errorf("%s: requested %q, want %q", step, got, wantPath)
+		}
+		return points[float64](t, collect(t, reader), "opensearch.index.indexing.rate")
+	}
+
+	collectRates("first scrape", "/logs-000001/_stats/indexing,search")
+	clock.Advance(10 * time.Second)
+	setTotals("logs-000001", 200, 20)
+	if got := collectRates("second scrape", "/logs-000001/_stats/indexing,search"); got["index=logs-000001"] != 10 {
+		t.Errorf("indexing rate = %v, want 10/s for logs-000001", got)
+	}
+
+	// After a rollover the new index is picked up on the next refresh. It
+	// has no previous totals, so it reports no rate yet.
+	srv.SetAlias("logs", "logs-000002")
+	clock.Advance(5 * time.Minute)
+	if got := collectRates("after the rollover", "/logs-000002/_stats/indexing,search"); len(got) != 0 {
+		t.Errorf("indexing rate = %v, want none for a new index", got)
+	}
+
+	// A failed refresh keeps scraping the previous indices.
+	srv.SetResponse("/_alias/logs", http.StatusInternalServerError, `{"error":"boom"}`)
+	clock.Advance(5 * time.Minute)
+	collectRates("failed refresh", "/logs-000002/_stats/indexing,search")
+}
+
+func TestIndexRateCollectorEmptyAlias(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+	c, err := opensearch.NewIndexRateCollector(srv.URL, provider, opensearch.Config{Aliases: []string{"missing"}})
+	if err != nil {
+		t.Fatalf("NewIndexRateCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	// An alias without indices must not fall back to _stats for every index.
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("CollectMetrics: %v", err)
+	}
+	for _, request := range srv.Requests() {
+		if strings.Contains(request, "_stats") {
+			t.Errorf("requested %s for an empty alias", request)
+		}
+	}
+}
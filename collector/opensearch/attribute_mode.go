@@ -0,0 +1,115 @@
+package opensearch
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AttributeMode controls which attributes the per-shard metrics carry, and
+// so how many series they produce.
+type AttributeMode string
+
+const (
+	// AttributeModeFull labels every shard copy with index, shard, prirep,
+	// state, node and ip. Cardinality grows with shards × replicas and
+	// changes whenever a shard moves between nodes. It is the default.
+	AttributeModeFull AttributeMode = "full"
+	// AttributeModeNoHost drops node and ip, so series stay stable across
+	// relocations. Replicas of the same shard in the same state are summed.
+	AttributeModeNoHost AttributeMode = "nohost"
+	// AttributeModeIndex aggregates shards per index, prirep and state. It
+	// produces a handful of series per index regardless of shard count, at
+	// the cost of per-shard detail.
+	AttributeModeIndex AttributeMode = "index"
+)
+
+func (m AttributeMode) validate() error {
+	switch m {
+	case AttributeModeFull, AttributeModeNoHost, AttributeModeIndex:
+		return nil
+	default:
+		return fmt.Errorf("unknown attribute mode %q", m)
+	}
+}
+
+// shardSeries is one series of the per-shard metrics: the shards sharing an
+// attribute set, with their values summed.
+type shardSeries struct {
+	attrs       attribute.Set
+	shards      int64
+	storeBytes  float64
+	hasStore    bool
+	docs        int64
+	hasDocs     bool
+	memory      []sizeValue
+	segments    int64
+	hasSegments bool
+}
+
+// shardSeries groups samples by the attributes of the configured
+// AttributeMode, skipping states excluded by ObserveStates. Grouping also
+// keeps copies with identical attributes, such as two unassigned replicas of
+// one shard, from overwriting each other.
+func (c *ShardCollector) shardSeries(samples []shardSample) []*shardSeries {
+	byAttrs := make(map[attribute.Distinct]*shardSeries)
+	var series []*shardSeries
+
+	for _, sample := range samples {
+		if len(c.cfg.ObserveStates) > 0 && !containsFold(c.cfg.ObserveStates, sample.State) {
+			continue
+		}
+
+		attrs := attribute.NewSet(c.seriesAttributes(sample.ShardInfo)...)
+		s, ok := byAttrs[attrs.Equivalent()]
+		if !ok {
+			s = &shardSeries{attrs: attrs}
+			byAttrs[attrs.Equivalent()] = s
+			series = append(series, s)
+		}
+
+		s.shards++
+		if sample.hasStore && sample.storeBytes >= float64(c.cfg.MinStoreBytes) {
+			s.storeBytes += sample.storeBytes
+			s.hasStore = true
+		}
+		if sample.hasDocs {
+			s.docs += sample.docs
+			s.hasDocs = true
+		}
+		if sample.hasSegments {
+			s.segments += sample.segments
+			s.hasSegments = true
+		}
+		if s.memory == nil && sample.memory != nil {
+			s.memory = make([]sizeValue, len(sample.memory))
+		}
+		for i, value := range sample.memory {
+			if value.ok {
+				s.memory[i].bytes += value.bytes
+				s.memory[i].ok = true
+			}
+		}
+	}
+	return series
+}
+
+func (c *ShardCollector) seriesAttributes(shard ShardInfo) []attribute.KeyValue {
+	switch c.cfg.AttributeMode {
+	case AttributeModeNoHost:
+		return []attribute.KeyValue{
+			attribute.String("index", shard.Index),
+			attribute.String("shard", shard.Shard),
+			attribute.String("prirep", shard.Prirep),
+			attribute.String("state", shard.State),
+		}
+	case AttributeModeIndex:
+		return []attribute.KeyValue{
+			attribute.String("index", shard.Index),
+			attribute.String("prirep", shard.Prirep),
+			attribute.String("state", shard.State),
+		}
+	default:
+		return shardAttributes(shard)
+	}
+}
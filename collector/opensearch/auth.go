@@ -0,0 +1,68 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TokenProvider supplies bearer tokens for OpenSearch requests, e.g. from a
+// cloud IAM service. Token returns a token and when it expires; a zero expiry
+// means it never does. Tokens are cached until shortly before they expire or
+// until OpenSearch rejects one with 401.
+type TokenProvider interface {
+	Token(ctx context.Context) (token string, expiry time.Time, err error)
+}
+
+// TokenProviderFunc adapts a function to TokenProvider.
+type TokenProviderFunc func(ctx context.Context) (string, time.Time, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (string, time.Time, error) {
+	return f(ctx)
+}
+
+// StaticToken is a TokenProvider that always returns the same token.
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, time.Time, error) {
+	return string(t), time.Time{}, nil
+}
+
+// tokenRefreshMargin renews a token this long before its expiry, so it
+// doesn't lapse while a request is in flight.
+const tokenRefreshMargin = 30 * time.Second
+
+// tokenCache caches the token of a TokenProvider between requests.
+type tokenCache struct {
+	provider TokenProvider
+	clock    Clock
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	valid  bool
+}
+
+func (c *tokenCache) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && (c.expiry.IsZero() || c.clock.Now().Add(tokenRefreshMargin).Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	token, expiry, err := c.provider.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+	c.token, c.expiry, c.valid = token, expiry, true
+	return token, nil
+}
+
+// invalidate drops the cached token so the next request fetches a new one.
+func (c *tokenCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+}
@@ -0,0 +1,64 @@
+package opensearch_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"instrumentation/collector/opensearch"
+	"instrumentation/collector/opensearch/opensearchtest"
+)
+
+func TestTokenProviderCachesUntilExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		lifetime  time.Duration
+		advance   []time.Duration
+		wantCalls []int
+	}{
+		{
+			name:     "refreshed shortly before expiry",
+			lifetime: 5 * time.Minute,
+			// The token is renewed 30s before it expires.
+			advance:   []time.Duration{0, 4 * time.Minute, 29 * time.Second, 2 * time.Second, time.Minute},
+			wantCalls: []int{1, 1, 1, 2, 2},
+		},
+		{
+			name:      "never expires",
+			advance:   []time.Duration{0, time.Hour, 24 * time.Hour},
+			wantCalls: []int{1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := opensearchtest.NewServer()
+			defer srv.Close()
+			clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+
+			calls := 0
+			provider := opensearch.TokenProviderFunc(func(context.Context) (string, time.Time, error) {
+				calls++
+				var expiry time.Time
+				if tt.lifetime > 0 {
+					expiry = clock.Now().Add(tt.lifetime)
+				}
+				return fmt.Sprintf("token-%d", calls), expiry, nil
+			})
+			c, _ := newTestCollector(t, srv, opensearch.WithClock(clock), opensearch.WithTokenProvider(provider))
+
+			for i, d := range tt.advance {
+				clock.Advance(d)
+				if _, err := c.CollectOnce(context.Background()); err != nil {
+					t.Fatalf("CollectOnce: %v", err)
+				}
+				if calls != tt.wantCalls[i] {
+					t.Errorf("after %d scrapes: provider called %d times, want %d", i+1, calls, tt.wantCalls[i])
+				}
+				if last, _ := c.LastScrape(); !last.Equal(clock.Now()) {
+					t.Errorf("last scrape at %s, want the fake time %s", last, clock.Now())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package opensearch
+
+import "sync"
+
+// breaker is a circuit breaker over scrape cycles. After threshold
+// consecutive failures it opens and skips ticks, doubling the number of
+// skipped ticks after every failed probe up to maxSkip. The first
+// successful probe closes it again.
+type breaker struct {
+	threshold int
+	maxSkip   int
+
+	mu       sync.Mutex
+	failures int
+	backoff  int
+	skip     int
+}
+
+func newBreaker(cfg Config) *breaker {
+	b := &breaker{threshold: cfg.BreakerThreshold}
+	if b.threshold > 0 {
+		b.maxSkip = max(int(cfg.BreakerMaxInterval/cfg.ScrapeInterval)-1, 0)
+	}
+	return b
+}
+
+// allow reports whether the current tick should collect, consuming a
+// skipped tick if it shouldn't.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.skip > 0 {
+		b.skip--
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a cycle and reports
+// whether that opened or closed it.
+func (b *breaker) record(err error) (opened, closed bool) {
+	if b.threshold == 0 {
+		return false, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		closed = b.failures >= b.threshold
+		b.failures, b.backoff, b.skip = 0, 0, 0
+		return false, closed
+	}
+
+	b.failures++
+	if b.failures < b.threshold {
+		return false, false
+	}
+	b.backoff = min(max(2*b.backoff, 1), b.maxSkip)
+	b.skip = b.backoff
+	return b.failures == b.threshold, false
+}
+
+// open reports whether the breaker is open.
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold
+}
@@ -0,0 +1,148 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// tick drives b through ticks like Runner.Run until a cycle has run for each
+// of outcomes, and returns a trace with F or S for cycles that failed or
+// succeeded and . for skipped ticks.
+func tick(b *breaker, outcomes string) string {
+	var trace strings.Builder
+	for i := 0; i < len(outcomes); {
+		if !b.allow() {
+			trace.WriteByte('.')
+			continue
+		}
+		var err error
+		if outcomes[i] == 'F' {
+			err = errors.New("cluster down")
+		}
+		b.record(err)
+		trace.WriteByte(outcomes[i])
+		i++
+	}
+	return trace.String()
+}
+
+func TestBreakerSkipsAndResets(t *testing.T) {
+	b := newBreaker(Config{BreakerThreshold: 3, ScrapeInterval: time.Minute, BreakerMaxInterval: 8 * time.Minute})
+
+	// After three failures every failed probe doubles the skipped ticks, up
+	// to seven so probes are at most eight intervals apart.
+	if got, want := tick(b, "FFFFFFF"), "FFF.F..F....F.......F"; got != want {
+		t.Errorf("while failing: %q, want %q", got, want)
+	}
+	if !b.open() {
+		t.Error("breaker closed after repeated failures")
+	}
+
+	// The next probe is seven ticks away. It succeeds, which closes the
+	// breaker, and scraping resumes every tick.
+	if got, want := tick(b, "SS"), ".......SS"; got != want {
+		t.Errorf("after recovery: %q, want %q", got, want)
+	}
+	if b.open() {
+		t.Error("breaker still open after a successful probe")
+	}
+
+	// Failures are counted afresh and the backoff starts over.
+	if got, want := tick(b, "FFSFFFF"), "FFSFFF.F"; got != want {
+		t.Errorf("after a reset: %q, want %q", got, want)
+	}
+}
+
+func TestBreakerReportsTransitions(t *testing.T) {
+	b := newBreaker(Config{BreakerThreshold: 2, ScrapeInterval: time.Minute, BreakerMaxInterval: 4 * time.Minute})
+	failed := errors.New("cluster down")
+
+	steps := []struct {
+		err                    error
+		wantOpened, wantClosed bool
+	}{
+		{err: failed},
+		{err: failed, wantOpened: true},
+		{err: failed},
+		{err: nil, wantClosed: true},
+		{err: nil},
+	}
+	for i, step := range steps {
+		opened, closed := b.record(step.err)
+		if opened != step.wantOpened || closed != step.wantClosed {
+			t.Errorf("step %d: opened, closed = %t, %t, want %t, %t", i, opened, closed, step.wantOpened, step.wantClosed)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(Config{ScrapeInterval: time.Minute, BreakerMaxInterval: 10 * time.Minute})
+	if got, want := tick(b, "FFFFFFFF"), "FFFFFFFF"; got != want {
+		t.Errorf("disabled breaker: %q, want %q", got, want)
+	}
+	if b.open() {
+		t.Error("disabled breaker opened")
+	}
+}
+
+func TestRunnerBreakerState(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		catShardsHandler(map[string][]ShardInfo{
+			"logs": {{Index: "logs", Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", DocsDeleted: "0", Store: "1kb", Node: "node-1"}},
+		})(w, r)
+	}))
+	reader := sdkmetric.NewManualReader()
+	c, err := NewShardCollector(context.Background(),
+		WithConfig(Config{BreakerThreshold: 2, Logger: discardLogger}),
+		WithOpenSearchEndpoint(srv.URL),
+		WithReader(reader),
+		WithIndices("logs"),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+	r, err := NewRunner(c)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	state := func() int64 {
+		t.Helper()
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		gauge, ok := findMetric(rm, "opensearch.collector.breaker.state").Data.(metricdata.Gauge[int64])
+		if !ok || len(gauge.DataPoints) != 1 {
+			t.Fatalf("breaker state = %+v, want one gauge point", gauge)
+		}
+		return gauge.DataPoints[0].Value
+	}
+
+	for i, want := range []int64{0, 1} {
+		r.recordCycle(r.Collect(context.Background()))
+		if got := state(); got != want {
+			t.Errorf("after %d failed cycles: breaker state = %d, want %d", i+1, got, want)
+		}
+	}
+	failing.Store(false)
+	r.recordCycle(r.Collect(context.Background()))
+	if got := state(); got != 0 {
+		t.Errorf("after recovery: breaker state = %d, want 0", got)
+	}
+}
@@ -0,0 +1,44 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Version and Commit describe the running build. They are set at link time:
+//
+//	go build -ldflags "-X instrumentation/collector/opensearch.Version=1.2.0 -X instrumentation/collector/opensearch.Commit=$(git rev-parse --short HEAD)"
+//
+// Version is also the default Config.ServiceVersion.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// registerBuildInfo registers opensearch.collector.build.info, a constant 1
+// labelled with the build metadata, so deployed versions can be audited.
+func (c *ShardCollector) registerBuildInfo() error {
+	attrs := metric.WithAttributeSet(attribute.NewSet(
+		attribute.String("version", Version),
+		attribute.String("commit", Commit),
+		attribute.String("go_version", runtime.Version()),
+	))
+
+	_, err := c.meter.Int64ObservableGauge(
+		"opensearch.collector.build.info",
+		metric.WithDescription("Always 1, labelled with the agent version, git commit and Go version"),
+		metric.WithUnit("1"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(1, attrs)
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create build info gauge: %w", err)
+	}
+	return nil
+}
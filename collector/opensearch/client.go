@@ -0,0 +1,414 @@
+package opensearch
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// maxRetryDelay caps the exponential backoff between retries.
+const maxRetryDelay = 30 * time.Second
+
+// client performs requests against the OpenSearch REST API with the
+// authentication, TLS and retry settings from Config. It is shared by all
+// collectors in this package.
+type client struct {
+	http      *http.Client
+	endpoints []string
+	cfg       Config
+	tokens    *tokenCache
+
+	// next is the host index the next scrape cycle starts from, and
+	// lastHost the endpoint that answered the most recent request.
+	next     atomic.Uint64
+	lastHost atomic.Value
+}
+
+// newClient creates a client for endpoint, which may be a comma separated
+// list of base URLs. Requests fail over to the next URL on connection errors.
+func newClient(endpoint string, cfg Config) (*client, error) {
+	var endpoints []string
+	for _, e := range strings.Split(endpoint, ",") {
+		e = strings.TrimSpace(e)
+		if err := validateEndpoint(e); err != nil {
+			return nil, fmt.Errorf("invalid OpenSearch endpoint %q: %w", e, err)
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure OpenSearch TLS: %w", err)
+	}
+	proxy, err := proxyFunc(cfg.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.ProxyURL, err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	c := &client{
+		http:      &http.Client{Transport: transport, Timeout: max(cfg.RequestTimeout, 0)},
+		endpoints: endpoints,
+		cfg:       cfg,
+	}
+	switch {
+	case cfg.TokenProvider != nil:
+		c.tokens = &tokenCache{provider: cfg.TokenProvider, clock: cfg.Clock}
+	case cfg.BearerToken != "":
+		c.tokens = &tokenCache{provider: StaticToken(cfg.BearerToken), clock: cfg.Clock}
+	}
+	return c, nil
+}
+
+// proxyFunc sends every request through proxyURL except those to hosts
+// excluded by the NO_PROXY environment variable. When proxyURL is empty the
+// HTTP_PROXY and HTTPS_PROXY variables pick the proxy. Unlike
+// http.ProxyFromEnvironment, which reads them once per process, the
+// environment is read when the client is created.
+func proxyFunc(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	env := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("scheme must be http, https or socks5")
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("missing host")
+		}
+		env.HTTPProxy, env.HTTPSProxy = proxyURL, proxyURL
+	}
+
+	proxy := env.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+// validateEndpoint checks that endpoint is an http or https base URL that
+// request paths can be appended to. It may include a path prefix, such as
+// https://gateway/opensearch, for clusters behind a reverse proxy.
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("must not contain a query or fragment")
+	}
+	return nil
+}
+
+// requestURL joins path onto the endpoint host, so endpoints served under a
+// prefix work with or without a trailing slash.
+func requestURL(host, path, query string) string {
+	// host was checked by validateEndpoint, so it always parses.
+	target, _ := url.JoinPath(host, path)
+	if query != "" {
+		target += "?" + query
+	}
+	return target
+}
+
+// hostOffsetKey carries the host index a scrape cycle starts from.
+type hostOffsetKey struct{}
+
+// withScrapeTimeout derives the context for one scrape cycle, bounded by
+// Config.ScrapeTimeout. Each cycle starts from the next host in turn so load
+// is spread across all endpoints.
+func (c *client) withScrapeTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, hostOffsetKey{}, c.next.Add(1)-1)
+	return context.WithTimeout(ctx, c.cfg.ScrapeTimeout)
+}
+
+// host returns the endpoint that answered the most recent request, or an
+// empty string before the first response.
+func (c *client) host() string {
+	host, _ := c.lastHost.Load().(string)
+	return host
+}
+
+// getJSON fetches path with the given query and decodes the JSON response
+// into v, which must be a pointer. v is left untouched unless the whole
+// response was read and decoded. Non-2xx responses are returned as a
+// *statusError.
+func (c *client) getJSON(ctx context.Context, path string, query string, v any) error {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newStatusError(resp)
+	}
+
+	decompressed, err := responseBody(resp)
+	if err != nil {
+		return &decodeError{err: err}
+	}
+	defer decompressed.Close()
+
+	body := &limitedBody{r: &io.LimitedReader{R: decompressed, N: c.cfg.MaxResponseBytes + 1}, limit: c.cfg.MaxResponseBytes}
+	if err := checkJSONContentType(resp, body); err != nil {
+		return &decodeError{err: err}
+	}
+	// The decoder reports a read error only after decoding what it already
+	// has, so decode into a fresh value and store it once the whole body has
+	// been read.
+	decoded := reflect.New(reflect.TypeOf(v).Elem())
+	if err := json.NewDecoder(body).Decode(decoded.Interface()); err != nil {
+		return &decodeError{err: err}
+	}
+	// The decoder stops after the value; reading on to EOF verifies the gzip
+	// checksum, so a truncated or corrupt stream is an error too.
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return &decodeError{err: err}
+	}
+	reflect.ValueOf(v).Elem().Set(decoded.Elem())
+	return nil
+}
+
+// checkJSONContentType rejects responses that declare a non-JSON content
+// type, such as the text tables _cat APIs return when a proxy strips
+// format=json. A missing Content-Type is let through to the decoder.
+func checkJSONContentType(resp *http.Response, body io.Reader) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(body, maxErrorBodySnippet))
+	return fmt.Errorf("expected a JSON response from %s but got Content-Type %q: %s",
+		resp.Request.URL.Path, contentType, strings.TrimSpace(string(snippet)))
+}
+
+// responseBody returns the decompressed body of resp. Requests ask for gzip
+// explicitly, which stops net/http from decompressing transparently.
+// Closing it releases the decompressor but not resp.Body.
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.NopCloser(resp.Body), nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gzip response: %w", err)
+	}
+	return gz, nil
+}
+
+// get issues an authenticated GET request for path, relative to the
+// endpoint and any path prefix it has. Connection errors and 5xx responses
+// are retried with exponential backoff and full jitter; 4xx responses are
+// returned to the caller without retrying. Within an attempt, a connection
+// error moves on to the next host before backing off.
+func (c *client) get(ctx context.Context, path, query string) (*http.Response, error) {
+	offset, _ := ctx.Value(hostOffsetKey{}).(uint64)
+	start := int(offset % uint64(len(c.endpoints)))
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		var (
+			resp *http.Response
+			err  error
+		)
+		for i := range c.endpoints {
+			host := c.endpoints[(start+i)%len(c.endpoints)]
+			resp, err = c.do(ctx, requestURL(host, path, query))
+			if err == nil {
+				c.lastHost.Store(host)
+				// Stay on the host that answered for the remaining attempts.
+				start = (start + i) % len(c.endpoints)
+				break
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if len(c.endpoints) > 1 {
+				c.cfg.Logger.Debug("OpenSearch host unreachable, trying next", "host", host, "error", err)
+			}
+		}
+
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && c.tokens != nil && !refreshed {
+			// The token may have been revoked or expired early. Fetch a new
+			// one and try again, once, without counting it as a retry.
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			c.tokens.invalidate()
+			refreshed = true
+			attempt--
+			continue
+		}
+
+		retryable := err != nil || resp.StatusCode >= 500
+		if !retryable || attempt >= c.cfg.MaxRetries || ctx.Err() != nil {
+			if err != nil {
+				return nil, fmt.Errorf("failed to execute request: %w", err)
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, backoff(c.cfg.RetryBaseDelay, attempt)); err != nil {
+			return nil, fmt.Errorf("gave up retrying request: %w", err)
+		}
+	}
+}
+
+func (c *client) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range c.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	switch {
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	case c.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.cfg.APIKey)
+	case c.tokens != nil:
+		token, err := c.tokens.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(req)
+}
+
+func backoff(base time.Duration, attempt int) time.Duration {
+	delay := base << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return rand.N(delay) + 1
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// maxErrorBodySnippet bounds how much of an error response is included in
+// the returned error.
+const maxErrorBodySnippet = 512
+
+type statusError struct {
+	StatusCode int
+	Path       string
+	Body       string
+}
+
+func newStatusError(resp *http.Response) *statusError {
+	var body []byte
+	if r, err := responseBody(resp); err == nil {
+		body, _ = io.ReadAll(io.LimitReader(r, maxErrorBodySnippet))
+		r.Close()
+	}
+	return &statusError{
+		StatusCode: resp.StatusCode,
+		Path:       resp.Request.URL.Path,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s: %s", e.StatusCode, e.Path, e.Body)
+}
+
+// ErrResponseTooLarge is returned, wrapped, when an OpenSearch response
+// exceeds Config.MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// limitedBody fails reads once more than limit bytes have been read, rather
+// than silently truncating like io.LimitReader, so the decoder reports the
+// cause instead of an unexpected EOF.
+type limitedBody struct {
+	r     *io.LimitedReader
+	limit int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if b.r.N <= 0 {
+		return n, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, b.limit)
+	}
+	return n, err
+}
+
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("failed to decode response: %v", e.err)
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+func isNotFound(err error) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// errorReason classifies a request error for the reason attribute of the
+// scrape errors counter.
+func errorReason(err error) string {
+	var (
+		statusErr *statusError
+		decodeErr *decodeError
+	)
+	switch {
+	case errors.As(err, &statusErr):
+		return "status"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	default:
+		return "http"
+	}
+}
@@ -0,0 +1,539 @@
+package opensearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient starts a server with handler and returns a client for it,
+// configured by cfg on top of the defaults.
+func newTestClient(t *testing.T, cfg Config, handler http.HandlerFunc) *client {
+	t.Helper()
+	srv := newTestServer(t, handler)
+	c, err := newClient(srv.URL, cfg.withDefaults())
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	return c
+}
+
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetJSONGzip(t *testing.T) {
+	const body = `[{"index":"logs","shard":"0"}]`
+	compressed := gzipped(t, body)
+	// The last eight bytes are the CRC-32 and length trailer.
+	corrupt := append([]byte(nil), compressed...)
+	corrupt[len(corrupt)-8] ^= 0xff
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantErr  bool
+	}{
+		{name: "plain", body: []byte(body)},
+		{name: "gzip", encoding: "gzip", body: compressed},
+		{name: "gzip upper case", encoding: "GZIP", body: compressed},
+		{name: "truncated gzip", encoding: "gzip", body: compressed[:len(compressed)-4], wantErr: true},
+		{name: "bad checksum", encoding: "gzip", body: corrupt, wantErr: true},
+		{name: "not gzip", encoding: "gzip", body: []byte(body), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acceptEncoding string
+			c := newTestClient(t, Config{}, func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Type", "application/json")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			})
+
+			var shards []ShardInfo
+			err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards)
+			if acceptEncoding != "gzip" {
+				t.Errorf("Accept-Encoding = %q, want gzip", acceptEncoding)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", shards)
+				}
+				if reason := errorReason(err); reason != "decode" {
+					t.Errorf("error reason = %q, want decode", reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getJSON: %v", err)
+			}
+			if len(shards) != 1 || shards[0].Index != "logs" || shards[0].Shard != "0" {
+				t.Errorf("got %+v", shards)
+			}
+		})
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	tests := []struct {
+		host, path, query string
+		want              string
+	}{
+		{"http://os:9200", "_cat/shards", "", "http://os:9200/_cat/shards"},
+		{"http://os:9200/", "_cat/shards", "", "http://os:9200/_cat/shards"},
+		{"http://os:9200", "_cat/shards/logs", "format=json", "http://os:9200/_cat/shards/logs?format=json"},
+		{"https://gw/opensearch", "_cat/shards", "", "https://gw/opensearch/_cat/shards"},
+		{"https://gw/opensearch/", "_cat/shards", "", "https://gw/opensearch/_cat/shards"},
+		{"https://gw/a/b/", "_cluster/health", "", "https://gw/a/b/_cluster/health"},
+	}
+	for _, tt := range tests {
+		if got := requestURL(tt.host, tt.path, tt.query); got != tt.want {
+			t.Errorf("requestURL(%q, %q, %q) = %q, want %q", tt.host, tt.path, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestGetUnderPathPrefix(t *testing.T) {
+	for _, prefix := range []string{"/opensearch", "/opensearch/"} {
+		t.Run(prefix, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			c, err := newClient(srv.URL+prefix, Config{}.withDefaults())
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			var v map[string]any
+			if err := c.getJSON(context.Background(), "_cluster/health", "", &v); err != nil {
+				t.Fatalf("getJSON: %v", err)
+			}
+			if gotPath != "/opensearch/_cluster/health" {
+				t.Errorf("path = %q, want /opensearch/_cluster/health", gotPath)
+			}
+		})
+	}
+}
+
+func TestGetJSONChecksContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{contentType: "application/json", body: `[]`},
+		{contentType: "application/json; charset=UTF-8", body: `[]`},
+		{contentType: "application/vnd.opensearch+json", body: `[]`},
+		{contentType: "", body: `[]`},
+		{
+			contentType: "text/plain; charset=UTF-8",
+			body:        "logs 0 p STARTED 100 512b 10.0.0.1 node-1\n",
+			wantErr:     `expected a JSON response from /_cat/shards but got Content-Type "text/plain; charset=UTF-8": logs 0 p STARTED 100 512b 10.0.0.1 node-1`,
+		},
+		{
+			contentType: "text/html",
+			body:        "<html>proxy login</html>",
+			wantErr:     `got Content-Type "text/html": <html>proxy login</html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			var accept string
+			c := newTestClient(t, Config{}, func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				if tt.contentType == "" {
+					// Stop net/http from sniffing a content type.
+					w.Header()["Content-Type"] = nil
+				} else {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Write([]byte(tt.body))
+			})
+
+			var shards []ShardInfo
+			err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards)
+			if accept != "application/json" {
+				t.Errorf("Accept = %q, want application/json", accept)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("getJSON: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("getJSON succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+			if reason := errorReason(err); reason != "decode" {
+				t.Errorf("error reason = %q, want decode", reason)
+			}
+		})
+	}
+}
+
+func TestGetJSONResponseLimit(t *testing.T) {
+	body := `[` + strings.Repeat(`{"index":"logs","shard":"0"},`, 99) + `{"index":"logs","shard":"0"}]`
+	size := int64(len(body))
+	// Whitespace compresses well, so this body is well under the limit on
+	// the wire but not once decompressed.
+	padded := body + strings.Repeat(" ", 1<<20)
+
+	tests := []struct {
+		name    string
+		gzip    bool
+		body    string
+		limit   int64
+		wantErr bool
+	}{
+		{name: "plain at the limit", body: body, limit: size},
+		{name: "plain over the limit", body: body, limit: size - 1, wantErr: true},
+		{name: "gzip at the limit", gzip: true, body: body, limit: size},
+		{name: "gzip over the limit", gzip: true, body: body, limit: size - 1, wantErr: true},
+		{name: "gzip over the limit once decompressed", gzip: true, body: padded, limit: 64 << 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.body)
+			if tt.gzip {
+				payload = gzipped(t, tt.body)
+				if tt.body == padded && int64(len(payload)) >= tt.limit {
+					t.Fatalf("compressed body is %d bytes, want it under the %d byte limit", len(payload), tt.limit)
+				}
+			}
+			c := newTestClient(t, Config{MaxResponseBytes: tt.limit}, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.gzip {
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				w.Write(payload)
+			})
+
+			var shards []ShardInfo
+			err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("getJSON: %v", err)
+				}
+				if len(shards) != 100 {
+					t.Errorf("decoded %d shards, want 100", len(shards))
+				}
+				return
+			}
+			if !errors.Is(err, ErrResponseTooLarge) {
+				t.Fatalf("getJSON error = %v, want ErrResponseTooLarge", err)
+			}
+			if reason := errorReason(err); reason != "decode" {
+				t.Errorf("error reason = %q, want decode", reason)
+			}
+			if shards != nil {
+				t.Errorf("decoded %d shards from an over-limit response, want none", len(shards))
+			}
+		})
+	}
+}
+
+func TestRequestAuthorization(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "none", want: ""},
+		{
+			name: "basic auth",
+			cfg:  Config{Username: "agent", Password: "s3cret"},
+			want: "Basic YWdlbnQ6czNjcmV0",
+		},
+		{name: "password without username", cfg: Config{Password: "s3cret"}, want: ""},
+		{name: "API key", cfg: Config{APIKey: "a2V5"}, want: "ApiKey a2V5"},
+		{name: "bearer token", cfg: Config{BearerToken: "t0ken"}, want: "Bearer t0ken"},
+		{
+			name: "token provider",
+			cfg:  Config{TokenProvider: StaticToken("fr3sh")},
+			want: "Bearer fr3sh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			c := newTestClient(t, tt.cfg, func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Values("Authorization")
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`[]`))
+			})
+
+			var shards []ShardInfo
+			if err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards); err != nil {
+				t.Fatalf("getJSON: %v", err)
+			}
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Authorization = %q, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMethodsAreExclusive(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "basic auth", cfg: Config{Username: "agent", Password: "s3cret"}},
+		{name: "API key", cfg: Config{APIKey: "a2V5"}},
+		{
+			name:    "basic auth and API key",
+			cfg:     Config{Username: "agent", APIKey: "a2V5"},
+			wantErr: "only one OpenSearch auth method may be configured, got basic auth and API key",
+		},
+		{
+			name:    "API key and bearer token",
+			cfg:     Config{APIKey: "a2V5", BearerToken: "t0ken"},
+			wantErr: "got API key and bearer token",
+		},
+		{
+			name:    "bearer token and token provider",
+			cfg:     Config{BearerToken: "t0ken", TokenProvider: StaticToken("fr3sh")},
+			wantErr: "got bearer token and token provider",
+		},
+		{
+			name:    "Authorization header",
+			cfg:     Config{Headers: map[string]string{"authorization": "Basic YWdlbnQ6czNjcmV0"}},
+			wantErr: `header "authorization" is set by the collector and can't be overridden`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.withDefaults().validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{name: "success", maxRetries: 3, statuses: []int{200}, wantAttempts: 1},
+		{name: "5xx then success", maxRetries: 3, statuses: []int{503, 500, 200}, wantAttempts: 3},
+		{name: "5xx until retries run out", maxRetries: 2, statuses: []int{503, 503, 503, 503}, wantAttempts: 3, wantStatus: 503},
+		{name: "no retries", statuses: []int{502, 200}, wantAttempts: 1, wantStatus: 502},
+		{name: "4xx is not retried", maxRetries: 3, statuses: []int{404, 200}, wantAttempts: 1, wantStatus: 404},
+		{name: "429 is not retried", maxRetries: 3, statuses: []int{429, 200}, wantAttempts: 1, wantStatus: 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			c := newTestClient(t, Config{MaxRetries: tt.maxRetries, RetryBaseDelay: time.Millisecond}, func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts]
+				attempts++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				w.Write([]byte(`[]`))
+			})
+
+			var shards []ShardInfo
+			err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards)
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Errorf("getJSON: %v", err)
+				}
+				return
+			}
+			var statusErr *statusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+				t.Errorf("getJSON error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGetRetriesConnectionErrors(t *testing.T) {
+	attempts := 0
+	c := newTestClient(t, Config{MaxRetries: 2, RetryBaseDelay: time.Millisecond}, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			// Drop the connection without a response.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+
+	var shards []ShardInfo
+	if err := c.getJSON(context.Background(), "_cat/shards", "format=json", &shards); err != nil {
+		t.Fatalf("getJSON: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestGetStopsRetryingWhenCancelled(t *testing.T) {
+	attempts := 0
+	c := newTestClient(t, Config{MaxRetries: 5, RetryBaseDelay: time.Hour}, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var shards []ShardInfo
+	err := c.getJSON(ctx, "_cat/shards", "format=json", &shards)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("getJSON error = %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("getJSON returned after %v, want it to stop at the deadline", elapsed)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const base = 100 * time.Millisecond
+	for attempt := range 12 {
+		limit := min(base<<attempt, maxRetryDelay)
+		for range 100 {
+			if d := backoff(base, attempt); d <= 0 || d > limit {
+				t.Fatalf("backoff(%v, %d) = %v, want it in (0, %v]", base, attempt, d, limit)
+			}
+		}
+	}
+	// A shift past the width of a Duration must still be capped.
+	if d := backoff(base, 80); d <= 0 || d > maxRetryDelay {
+		t.Errorf("backoff(%v, 80) = %v, want it in (0, %v]", base, d, maxRetryDelay)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	// The proxy environment never applies to loopback hosts, so the client
+	// asks for a made-up host that is dialled at the direct server below.
+	const endpoint = "http://opensearch.test:9200"
+
+	tests := []struct {
+		name        string
+		proxyURL    bool
+		env         map[string]string
+		wantProxied bool
+	}{
+		{name: "ProxyURL", proxyURL: true, wantProxied: true},
+		{name: "ProxyURL with NO_PROXY", proxyURL: true, env: map[string]string{"NO_PROXY": "opensearch.test"}},
+		{name: "HTTP_PROXY", env: map[string]string{"HTTP_PROXY": "proxy"}, wantProxied: true},
+		{name: "HTTPS_PROXY only", env: map[string]string{"HTTPS_PROXY": "proxy"}},
+		{name: "HTTP_PROXY with NO_PROXY", env: map[string]string{"HTTP_PROXY": "proxy", "NO_PROXY": ".test"}},
+		{name: "no proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proxied, direct atomic.Int32
+			respond := func(count *atomic.Int32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					if r.Host != "opensearch.test:9200" {
+						t.Errorf("request for host %q, want opensearch.test:9200", r.Host)
+					}
+					count.Add(1)
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{}`))
+				}
+			}
+			proxy := newTestServer(t, respond(&proxied))
+			directSrv := newTestServer(t, respond(&direct))
+
+			for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+				v := tt.env[name]
+				if v == "proxy" {
+					v = proxy.URL
+				}
+				t.Setenv(name, v)
+				t.Setenv(strings.ToLower(name), "")
+			}
+			var cfg Config
+			if tt.proxyURL {
+				cfg.ProxyURL = proxy.URL
+			}
+			c, err := newClient(endpoint, cfg.withDefaults())
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			transport := c.http.Transport.(*http.Transport)
+			dial := transport.DialContext
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if addr == "opensearch.test:9200" {
+					addr = directSrv.Listener.Addr().String()
+				}
+				return dial(ctx, network, addr)
+			}
+
+			var v map[string]any
+			if err := c.getJSON(context.Background(), "_cluster/health", "", &v); err != nil {
+				t.Fatalf("getJSON: %v", err)
+			}
+			wantProxied, wantDirect := int32(0), int32(1)
+			if tt.wantProxied {
+				wantProxied, wantDirect = 1, 0
+			}
+			if proxied.Load() != wantProxied || direct.Load() != wantDirect {
+				t.Errorf("%d requests through the proxy and %d direct, want %d and %d",
+					proxied.Load(), direct.Load(), wantProxied, wantDirect)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ClusterHealthCollector reports cluster level health from _cluster/health.
+// It records into a MeterProvider owned by another collector, typically a
+// ShardCollector, so both share one exporter.
+type ClusterHealthCollector struct {
+	client       *client
+	meter        metric.Meter
+	registration metric.Registration
+
+	mu     sync.RWMutex
+	health *ClusterHealth
+}
+
+type ClusterHealth struct {
+	ClusterName         string `json:"cluster_name"`
+	Status              string `json:"status"`
+	NumberOfNodes       int64  `json:"number_of_nodes"`
+	ActiveShards        int64  `json:"active_shards"`
+	RelocatingShards    int64  `json:"relocating_shards"`
+	InitializingShards  int64  `json:"initializing_shards"`
+	UnassignedShards    int64  `json:"unassigned_shards"`
+	ActivePrimaryShards int64  `json:"active_primary_shards"`
+}
+
+// clusterStatusValues maps the health status to the value of the
+// opensearch.cluster.status gauge.
+var clusterStatusValues = map[string]int64{
+	"green":  0,
+	"yellow": 1,
+	"red":    2,
+}
+
+func NewClusterHealthCollector(endpoint string, meterProvider metric.MeterProvider, cfg Config, opts ...CompanionOption) (*ClusterHealthCollector, error) {
+	o := newCompanionOptions(DefaultClusterHealthMeterName, opts)
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	client, err := newClient(endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ClusterHealthCollector{
+		client: client,
+		meter:  meterProvider.Meter(o.meterName),
+	}
+	if err := c.registerInstruments(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *ClusterHealthCollector) registerInstruments() error {
+	status, err := c.meter.Int64ObservableGauge(
+		"opensearch.cluster.status",
+		metric.WithDescription("Cluster health status: 0 green, 1 yellow, 2 red"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cluster status gauge: %w", err)
+	}
+
+	counts := []struct {
+		name        string
+		description string
+		value       func(*ClusterHealth) int64
+		gauge       metric.Int64ObservableGauge
+	}{
+		{name: "opensearch.cluster.active_shards", description: "Number of active shards", value: func(h *ClusterHealth) int64 { return h.ActiveShards }},
+		{name: "opensearch.cluster.active_primary_shards", description: "Number of active primary shards", value: func(h *ClusterHealth) int64 { return h.ActivePrimaryShards }},
+		{name: "opensearch.cluster.relocating_shards", description: "Number of relocating shards", value: func(h *ClusterHealth) int64 { return h.RelocatingShards }},
+		{name: "opensearch.cluster.initializing_shards", description: "Number of initializing shards", value: func(h *ClusterHealth) int64 { return h.InitializingShards }},
+		{name: "opensearch.cluster.unassigned_shards", description: "Number of unassigned shards", value: func(h *ClusterHealth) int64 { return h.UnassignedShards }},
+		{name: "opensearch.cluster.number_of_nodes", description: "Number of nodes in the cluster", value: func(h *ClusterHealth) int64 { return h.NumberOfNodes }},
+	}
+
+	instruments := []metric.Observable{status}
+	for i := range counts {
+		counts[i].gauge, err = c.meter.Int64ObservableGauge(counts[i].name, metric.WithDescription(counts[i].description))
+		if err != nil {
+			return fmt.Errorf("failed to create %s gauge: %w", counts[i].name, err)
+		}
+		instruments = append(instruments, counts[i].gauge)
+	}
+
+	c.registration, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		health := c.health
+		c.mu.RUnlock()
+
+		if health == nil {
+			return nil
+		}
+
+		attrs := metric.WithAttributes(attribute.String("cluster", health.ClusterName))
+		if value, ok := clusterStatusValues[health.Status]; ok {
+			o.ObserveInt64(status, value, attrs)
+		}
+		for _, count := range counts {
+			o.ObserveInt64(count.gauge, count.value(health), attrs)
+		}
+		return nil
+	}, instruments...)
+	if err != nil {
+		return fmt.Errorf("failed to register callback: %w", err)
+	}
+
+	return nil
+}
+
+// CollectMetrics fetches the current cluster health and stores it for the
+// next export.
+func (c *ClusterHealthCollector) CollectMetrics(ctx context.Context) error {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	var health ClusterHealth
+	if err := c.client.getJSON(ctx, "_cluster/health", "", &health); err != nil {
+		return fmt.Errorf("failed to fetch cluster health: %w", err)
+	}
+
+	c.mu.Lock()
+	c.health = &health
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Shutdown stops observing cluster health. The MeterProvider is owned by the
+// caller and is not shut down.
+func (c *ClusterHealthCollector) Shutdown(_ context.Context) error {
+	return c.registration.Unregister()
+}
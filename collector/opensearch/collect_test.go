@@ -0,0 +1,1071 @@
+package opensearch_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"instrumentation/collector/opensearch"
+	"instrumentation/collector/opensearch/opensearchtest"
+)
+
+// newTestCollector returns a collector scraping srv that records into a
+// ManualReader, so tests can Collect and inspect what would be exported.
+func newTestCollector(t testing.TB, srv *opensearchtest.Server, opts ...opensearch.Option) (*opensearch.ShardCollector, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	opts = append(opts, opensearch.WithOpenSearchEndpoint(srv.URL), opensearch.WithReader(reader))
+	c, err := opensearch.NewShardCollector(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+	return c, reader
+}
+
+// collect reads the current metrics from reader, keyed by name.
+func collect(t testing.TB, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+// points returns the values of the gauge or sum called name, keyed by their
+// attributes encoded as "key=value,..." in key order. A metric that wasn't
+// exported has no points.
+func points[N int64 | float64](t testing.TB, metrics map[string]metricdata.Metrics, name string) map[string]N {
+	t.Helper()
+	m, ok := metrics[name]
+	if !ok {
+		return nil
+	}
+	got := make(map[string]N)
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[N]:
+		for _, dp := range data.DataPoints {
+			got[dp.Attributes.Encoded(attribute.DefaultEncoder())] = dp.Value
+		}
+	case metricdata.Sum[N]:
+		for _, dp := range data.DataPoints {
+			got[dp.Attributes.Encoded(attribute.DefaultEncoder())] = dp.Value
+		}
+	default:
+		t.Fatalf("%s: unexpected data %T", name, m.Data)
+	}
+	return got
+}
+
+func assertPoints[N int64 | float64](t testing.TB, metrics map[string]metricdata.Metrics, name string, want map[string]N) {
+	t.Helper()
+	got := points[N](t, metrics, name)
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d points %v, want %d %v", name, len(got), got, len(want), want)
+		return
+	}
+	for attrs, value := range want {
+		if g, ok := got[attrs]; !ok || g != value {
+			t.Errorf("%s{%s} = %v (present %t), want %v", name, attrs, g, ok, value)
+		}
+	}
+}
+
+func TestCollectOnceReportsShards(t *testing.T) {
+	const (
+		logsPrimary = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		logsReplica = "index=logs,ip=10.0.0.2,node=node-2,prirep=r,shard=0,state=STARTED"
+		logsPending = "index=logs,ip=_unassigned,node=,prirep=r,shard=0,state=UNASSIGNED"
+		metrics0    = "index=metrics,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		metrics1    = "index=metrics,ip=10.0.0.2,node=node-2,prirep=p,shard=1,state=STARTED"
+	)
+	primary := opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "100", Store: "512b", IP: "10.0.0.1", Node: "node-1"}
+	replica := opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "STARTED", Docs: "100", Store: "512", IP: "10.0.0.2", Node: "node-2"}
+	unassigned := opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED", UnassignedReason: "NODE_LEFT"}
+
+	tests := []struct {
+		name      string
+		indices   []string
+		shards    map[string][]opensearch.ShardInfo
+		wantCount int
+		wantStore map[string]float64
+		wantDocs  map[string]int64
+		wantState map[string]int64
+	}{
+		{
+			name:      "primary and replica",
+			indices:   []string{"logs"},
+			shards:    map[string][]opensearch.ShardInfo{"logs": {primary, replica}},
+			wantCount: 2,
+			wantStore: map[string]float64{logsPrimary: 512, logsReplica: 512},
+			wantDocs:  map[string]int64{logsPrimary: 100, logsReplica: 100},
+			wantState: map[string]int64{logsPrimary: 1, logsReplica: 1},
+		},
+		{
+			name:      "unassigned replica has no store or docs",
+			indices:   []string{"logs"},
+			shards:    map[string][]opensearch.ShardInfo{"logs": {primary, unassigned}},
+			wantCount: 2,
+			wantStore: map[string]float64{logsPrimary: 512},
+			wantDocs:  map[string]int64{logsPrimary: 100},
+			wantState: map[string]int64{logsPrimary: 1, logsPending: 1},
+		},
+		{
+			name:    "multiple indices and units",
+			indices: []string{"logs", "metrics"},
+			shards: map[string][]opensearch.ShardInfo{
+				"logs": {primary},
+				"metrics": {
+					{Shard: "0", Prirep: "p", State: "STARTED", Docs: "7", Store: "1.5kb", IP: "10.0.0.1", Node: "node-1"},
+					{Shard: "1", Prirep: "p", State: "STARTED", Docs: "0", Store: "2GB", IP: "10.0.0.2", Node: "node-2"},
+				},
+			},
+			wantCount: 3,
+			wantStore: map[string]float64{logsPrimary: 512, metrics0: 1536, metrics1: 2 << 30},
+			wantDocs:  map[string]int64{logsPrimary: 100, metrics0: 7, metrics1: 0},
+			wantState: map[string]int64{logsPrimary: 1, metrics0: 1, metrics1: 1},
+		},
+		{
+			name:      "missing index is skipped",
+			indices:   []string{"logs", "gone"},
+			shards:    map[string][]opensearch.ShardInfo{"logs": {primary}},
+			wantCount: 1,
+			wantStore: map[string]float64{logsPrimary: 512},
+			wantDocs:  map[string]int64{logsPrimary: 100},
+			wantState: map[string]int64{logsPrimary: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := opensearchtest.NewServer()
+			defer srv.Close()
+			for index, shards := range tt.shards {
+				srv.SetShards(index, shards...)
+			}
+			c, reader := newTestCollector(t, srv, opensearch.WithIndices(tt.indices...))
+
+			shards, err := c.CollectOnce(context.Background())
+			if err != nil {
+				t.Fatalf("CollectOnce: %v", err)
+			}
+			if len(shards) != tt.wantCount {
+				t.Errorf("got %d shards, want %d: %+v", len(shards), tt.wantCount, shards)
+			}
+
+			metrics := collect(t, reader)
+			assertPoints(t, metrics, "opensearch.shard.store.size", tt.wantStore)
+			assertPoints(t, metrics, "opensearch.shard.docs.count", tt.wantDocs)
+			assertPoints(t, metrics, "opensearch.shard.state", tt.wantState)
+		})
+	}
+}
+
+func TestCollectOnceErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		text       bool
+		wantReason string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: `{"error":"boom"}`, wantReason: "status"},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{"error":"no"}`, wantReason: "status"},
+		{name: "malformed json", status: http.StatusOK, body: `[{"index":`, wantReason: "decode"},
+		{name: "wrong shape", status: http.StatusOK, body: `{"index":"logs"}`, wantReason: "decode"},
+		{name: "text table", status: http.StatusOK, body: "logs 0 p STARTED 100 512b", text: true, wantReason: "decode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := opensearchtest.NewServer()
+			defer srv.Close()
+			if tt.text {
+				srv.SetTextResponse("/_cat/shards/logs", tt.status, tt.body)
+			} else {
+				srv.SetResponse("/_cat/shards/logs", tt.status, tt.body)
+			}
+			c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+			if _, err := c.CollectOnce(context.Background()); err == nil {
+				t.Fatal("CollectOnce succeeded, want an error")
+			}
+			if _, err := c.LastScrape(); err == nil {
+				t.Error("LastScrape reports no error")
+			}
+
+			metrics := collect(t, reader)
+			assertPoints(t, metrics, "opensearch.collector.scrape.errors", map[string]int64{"reason=" + tt.wantReason: 1})
+			if got := points[int64](t, metrics, "opensearch.shard.state"); len(got) != 0 {
+				t.Errorf("shard state reported after a failed scrape: %v", got)
+			}
+		})
+	}
+}
+
+func TestCollectOnceSkipsMalformedValues(t *testing.T) {
+	const (
+		badStore = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		badDocs  = "index=logs,ip=10.0.0.2,node=node-2,prirep=p,shard=1,state=STARTED"
+	)
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "5", Store: "12qb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "p", State: "STARTED", Docs: "many", Store: "1kb", IP: "10.0.0.2", Node: "node-2"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+	// A malformed value only drops that value, not the shard or the scrape.
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.store.size", map[string]float64{badDocs: 1024})
+	assertPoints(t, metrics, "opensearch.shard.docs.count", map[string]int64{badStore: 5})
+	assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{badStore: 1, badDocs: 1})
+	assertPoints(t, metrics, "opensearch.collector.scrape.errors", map[string]int64{
+		"field=store,reason=parse": 1,
+		"field=docs,reason=parse":  1,
+	})
+}
+
+func TestCollectMetricsRegistersInstrumentsOnce(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1b", IP: "10.0.0.1", Node: "node-1"})
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+	shape := func() map[string]int {
+		t.Helper()
+		if err := c.CollectMetrics(context.Background()); err != nil {
+			t.Fatalf("CollectMetrics: %v", err)
+		}
+		shape := make(map[string]int)
+		for name, m := range collect(t, reader) {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				shape[name] = len(data.DataPoints)
+			case metricdata.Gauge[float64]:
+				shape[name] = len(data.DataPoints)
+			}
+		}
+		return shape
+	}
+
+	// Repeated collections must neither add instruments nor observe a
+	// series more than once.
+	want := shape()
+	for i := 0; i < 20; i++ {
+		got := shape()
+		if len(got) != len(want) {
+			t.Fatalf("collection %d: %d gauges, want %d", i, len(got), len(want))
+		}
+		for name, n := range want {
+			if got[name] != n {
+				t.Fatalf("collection %d: %s has %d points, want %d", i, name, got[name], n)
+			}
+		}
+	}
+	if want["opensearch.shard.store.size"] != 1 {
+		t.Errorf("store size has %d points, want 1", want["opensearch.shard.store.size"])
+	}
+}
+
+func TestShardDocsCountSkipsUnassigned(t *testing.T) {
+	const (
+		started    = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		empty      = "index=logs,ip=10.0.0.2,node=node-2,prirep=p,shard=1,state=STARTED"
+		unassigned = "index=logs,ip=_unassigned,node=,prirep=r,shard=0,state=UNASSIGNED"
+		nullDocs   = "index=logs,ip=_unassigned,node=,prirep=r,shard=1,state=UNASSIGNED"
+	)
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetResponse("/_cat/shards/logs", http.StatusOK, `[
+		{"index":"logs","shard":"0","prirep":"p","state":"STARTED","docs":"42","store":"1kb","ip":"10.0.0.1","node":"node-1"},
+		{"index":"logs","shard":"1","prirep":"p","state":"STARTED","docs":"0","store":"0b","ip":"10.0.0.2","node":"node-2"},
+		{"index":"logs","shard":"0","prirep":"r","state":"UNASSIGNED","docs":"","store":"","ip":"","node":""},
+		{"index":"logs","shard":"1","prirep":"r","state":"UNASSIGNED","docs":null,"store":null,"ip":null,"node":null}
+	]`)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.docs.count", map[string]int64{started: 42, empty: 0})
+	assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{started: 1, empty: 1, unassigned: 1, nullDocs: 1})
+	if got := points[int64](t, metrics, "opensearch.collector.scrape.errors"); len(got) != 0 {
+		t.Errorf("missing docs counted as scrape errors: %v", got)
+	}
+}
+
+func TestShardStateReportsShardsWithoutStore(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "INITIALIZING", IP: "10.0.0.2", Node: "node-2"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "p", State: "UNASSIGNED", UnassignedReason: "INDEX_CREATED"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "r", State: "UNASSIGNED", UnassignedReason: "INDEX_CREATED"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{
+		"index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED":      1,
+		"index=logs,ip=10.0.0.2,node=node-2,prirep=r,shard=0,state=INITIALIZING": 1,
+		"index=logs,ip=_unassigned,node=,prirep=p,shard=1,state=UNASSIGNED":      1,
+		"index=logs,ip=_unassigned,node=,prirep=r,shard=1,state=UNASSIGNED":      1,
+	})
+	assertPoints(t, metrics, "opensearch.shard.store.size", map[string]float64{
+		"index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED": 1024,
+	})
+}
+
+func TestFetchShardsRecordsNothing(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "3", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED"},
+	)
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{ExcludeStates: []string{"UNASSIGNED"}}),
+		opensearch.WithIndices("logs"),
+	)
+
+	shards, err := c.FetchShards(context.Background())
+	if err != nil {
+		t.Fatalf("FetchShards: %v", err)
+	}
+	if len(shards) != 1 || shards[0].Index != "logs" || shards[0].State != "STARTED" || shards[0].Store != "1kb" {
+		t.Fatalf("FetchShards = %+v, want the started primary of logs", shards)
+	}
+	if last, _ := c.LastScrape(); !last.IsZero() {
+		t.Errorf("FetchShards counted as a scrape at %s", last)
+	}
+	metrics := collect(t, reader)
+	for _, name := range []string{"opensearch.shard.state", "opensearch.shard.store.size", "opensearch.shards.total"} {
+		if m, ok := metrics[name]; ok {
+			t.Errorf("%s reported after FetchShards: %v", name, m.Data)
+		}
+	}
+
+	collected, err := c.CollectOnce(context.Background())
+	if err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	if len(collected) != 1 || collected[0] != shards[0] {
+		t.Errorf("CollectOnce = %+v, want %+v", collected, shards)
+	}
+	if last, _ := c.LastScrape(); last.IsZero() {
+		t.Error("CollectOnce did not record a scrape")
+	}
+	assertPoints(t, collect(t, reader), "opensearch.shard.state", map[string]int64{
+		"index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED": 1,
+	})
+}
+
+func TestNoStoreCountSeparatesEmptyFromZero(t *testing.T) {
+	const (
+		real  = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		zero  = "index=logs,ip=10.0.0.2,node=node-2,prirep=p,shard=1,state=STARTED"
+		empty = "index=logs,ip=_unassigned,node=,prirep=r,shard=0,state=UNASSIGNED"
+	)
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "9", Store: "3kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "p", State: "STARTED", Docs: "0", Store: "0b", IP: "10.0.0.2", Node: "node-2"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED"},
+	)
+	srv.SetShards("empty",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "0", Store: "0b", IP: "10.0.0.1", Node: "node-1"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs", "empty"))
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	// A 0 byte store is reported as such; a missing one is only counted.
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.store.size", map[string]float64{
+		real: 3072,
+		zero: 0,
+		"index=empty,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED": 0,
+	})
+	assertPoints(t, metrics, "opensearch.shards.no_store.count", map[string]int64{"index=logs": 1, "index=empty": 0})
+	if _, ok := points[float64](t, metrics, "opensearch.shard.store.size")[empty]; ok {
+		t.Error("unassigned shard reported a store size")
+	}
+}
+
+func TestWithReaderReplacesOTLPExporter(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"})
+
+	// Without a reader the OTLP exporter is used, which needs an endpoint.
+	if _, err := opensearch.NewShardCollector(context.Background(), opensearch.WithOpenSearchEndpoint(srv.URL)); err == nil {
+		t.Error("NewShardCollector without a reader or OTLP endpoint succeeded")
+	}
+
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{ServiceName: "test-agent"}),
+		opensearch.WithIndices("logs"),
+	)
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("CollectMetrics: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if name, _ := rm.Resource.Set().Value("service.name"); name.AsString() != "test-agent" {
+		t.Errorf("service.name = %q, want test-agent", name.AsString())
+	}
+	scopes := make(map[string]bool)
+	for _, scope := range rm.ScopeMetrics {
+		scopes[scope.Scope.Name] = true
+	}
+	if !scopes[opensearch.DefaultMeterName] {
+		t.Errorf("no metrics under scope %s: %v", opensearch.DefaultMeterName, scopes)
+	}
+
+	metrics := collect(t, reader)
+	for name, unit := range map[string]string{
+		"opensearch.shard.store.size":          "bytes",
+		"opensearch.shard.docs.count":          "{documents}",
+		"opensearch.shard.state":               "{shards}",
+		"opensearch.collector.scrape.duration": "s",
+	} {
+		m, ok := metrics[name]
+		if !ok {
+			t.Errorf("%s not exported", name)
+			continue
+		}
+		if m.Unit != unit {
+			t.Errorf("%s unit = %q, want %q", name, m.Unit, unit)
+		}
+		if m.Description == "" {
+			t.Errorf("%s has no description", name)
+		}
+	}
+}
+
+func TestShardAndIndexTotals(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	for i, index := range []string{"logs-1", "logs-2", "metrics"} {
+		var shards []opensearch.ShardInfo
+		for s := 0; s <= i; s++ {
+			shards = append(shards,
+				opensearch.ShardInfo{Shard: strconv.Itoa(s), Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+				opensearch.ShardInfo{Shard: strconv.Itoa(s), Prirep: "r", State: "UNASSIGNED"},
+			)
+		}
+		srv.SetShards(index, shards...)
+	}
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs-*", "metrics"))
+
+	// Totals are only reported once a scrape has succeeded.
+	metrics := collect(t, reader)
+	for _, name := range []string{"opensearch.shards.total", "opensearch.indices.total"} {
+		if _, ok := metrics[name]; ok {
+			t.Errorf("%s reported before the first scrape", name)
+		}
+	}
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	metrics = collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shards.total", map[string]int64{"": 12})
+	assertPoints(t, metrics, "opensearch.indices.total", map[string]int64{"": 3})
+
+	srv.DeleteIndex("logs-2")
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	metrics = collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shards.total", map[string]int64{"": 8})
+	assertPoints(t, metrics, "opensearch.indices.total", map[string]int64{"": 2})
+}
+
+func TestWithViewFiltersAndRenames(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.2", Node: "node-2"},
+	)
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithIndices("logs"),
+		opensearch.WithView(
+			sdkmetric.NewView(
+				sdkmetric.Instrument{Name: "opensearch.shard.store.size"},
+				sdkmetric.Stream{AttributeFilter: attribute.NewAllowKeysFilter("index", "prirep")},
+			),
+			sdkmetric.NewView(
+				sdkmetric.Instrument{Name: "opensearch.shard.docs.count"},
+				sdkmetric.Stream{Name: "shard_documents"},
+			),
+		),
+	)
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.store.size", map[string]float64{
+		"index=logs,prirep=p": 1024,
+		"index=logs,prirep=r": 1024,
+	})
+	if _, ok := metrics["opensearch.shard.docs.count"]; ok {
+		t.Error("renamed metric still exported under its own name")
+	}
+	if got := points[int64](t, metrics, "shard_documents"); len(got) != 2 {
+		t.Errorf("shard_documents = %v, want both copies", got)
+	}
+	// Metrics without a view of their own keep every attribute.
+	if got := points[int64](t, metrics, "opensearch.shard.state"); len(got) != 2 {
+		t.Errorf("opensearch.shard.state = %v, want both copies", got)
+	}
+}
+
+func TestPrimaryAndTotalStoreSize(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "5", Store: "10mb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "STARTED", Docs: "5", Store: "10mb", IP: "10.0.0.2", Node: "node-2"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "STARTED", Docs: "5", Store: "10mb", IP: "10.0.0.3", Node: "node-3"},
+	)
+	srv.SetShards("metrics",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs", "metrics"))
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.index.primary.store.size", map[string]float64{
+		"index=logs":    10 << 20,
+		"index=metrics": 1 << 10,
+	})
+	assertPoints(t, metrics, "opensearch.index.total.store.size", map[string]float64{
+		"index=logs":    30 << 20,
+		"index=metrics": 1 << 10,
+	})
+}
+
+func TestStoreSizeDistribution(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "p", State: "STARTED", Docs: "1", Store: "1mb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "2", Prirep: "p", State: "STARTED", Docs: "0", Store: "0b", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "3", Prirep: "r", State: "UNASSIGNED"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+
+	distribution := func() metricdata.ExponentialHistogramDataPoint[float64] {
+		t.Helper()
+		m, ok := collect(t, reader)["opensearch.shard.store.size.distribution"]
+		if !ok {
+			t.Fatal("distribution not exported")
+		}
+		hist, ok := m.Data.(metricdata.ExponentialHistogram[float64])
+		if !ok || len(hist.DataPoints) != 1 {
+			t.Fatalf("distribution = %#v, want one exponential histogram point", m.Data)
+		}
+		return hist.DataPoints[0]
+	}
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	// Collecting again must not record the shards a second time.
+	distribution()
+	dp := distribution()
+	if dp.Count != 3 {
+		t.Errorf("count = %d, want 3 shards with a store", dp.Count)
+	}
+	if dp.ZeroCount != 1 {
+		t.Errorf("zero count = %d, want 1", dp.ZeroCount)
+	}
+	var populated uint64
+	for _, n := range dp.PositiveBucket.Counts {
+		populated += n
+	}
+	if populated != 2 {
+		t.Errorf("positive buckets hold %d shards, want 2", populated)
+	}
+	if min, _ := dp.Min.Value(); min != 0 {
+		t.Errorf("min = %v, want 0", min)
+	}
+	if max, _ := dp.Max.Value(); max != 1<<20 {
+		t.Errorf("max = %v, want %v", max, 1<<20)
+	}
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	if dp := distribution(); dp.Count != 6 {
+		t.Errorf("count after a second scrape = %d, want 6", dp.Count)
+	}
+}
+
+func TestMinStoreBytesOnlyHidesSizeSeries(t *testing.T) {
+	const (
+		tiny  = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+		large = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=1,state=STARTED"
+	)
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "2", Store: "4kb", IP: "10.0.0.1", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "1", Prirep: "p", State: "STARTED", Docs: "8", Store: "2mb", IP: "10.0.0.1", Node: "node-1"},
+	)
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{MinStoreBytes: 1 << 20}),
+		opensearch.WithIndices("logs"),
+	)
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.shard.store.size", map[string]float64{large: 2 << 20})
+	assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{tiny: 1, large: 1})
+	assertPoints(t, metrics, "opensearch.shard.docs.count", map[string]int64{tiny: 2, large: 8})
+	assertPoints(t, metrics, "opensearch.shards.total", map[string]int64{"": 2})
+	assertPoints(t, metrics, "opensearch.index.total.store.size", map[string]float64{"index=logs": 2<<20 + 4<<10})
+	assertPoints(t, metrics, "opensearch.node.store.size", map[string]float64{"node=node-1": 2<<20 + 4<<10})
+}
+
+func TestEnabledAndDisabledMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    opensearch.Config
+		want   []string
+		absent []string
+	}{
+		{
+			name:   "disabled",
+			cfg:    opensearch.Config{DisabledMetrics: []string{"opensearch.shard.docs.count", "opensearch.node.*"}},
+			want:   []string{"opensearch.shard.store.size", "opensearch.shard.state", "opensearch.shards.total"},
+			absent: []string{"opensearch.shard.docs.count", "opensearch.node.shard.count", "opensearch.node.store.size"},
+		},
+		{
+			name:   "enabled",
+			cfg:    opensearch.Config{EnabledMetrics: []string{"opensearch.shards.*"}},
+			want:   []string{"opensearch.shards.total", "opensearch.shards.unassigned"},
+			absent: []string{"opensearch.shard.store.size", "opensearch.shard.state", "opensearch.indices.total"},
+		},
+		{
+			name:   "disabled wins over enabled",
+			cfg:    opensearch.Config{EnabledMetrics: []string{"opensearch.shard.*"}, DisabledMetrics: []string{"opensearch.shard.state"}},
+			want:   []string{"opensearch.shard.store.size", "opensearch.shard.docs.count"},
+			absent: []string{"opensearch.shard.state", "opensearch.shards.total"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := opensearchtest.NewServer()
+			defer srv.Close()
+			srv.SetShards("logs",
+				opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"},
+				opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED"},
+			)
+			c, reader := newTestCollector(t, srv, opensearch.WithConfig(tt.cfg), opensearch.WithIndices("logs"))
+			if _, err := c.CollectOnce(context.Background()); err != nil {
+				t.Fatalf("CollectOnce: %v", err)
+			}
+
+			metrics := collect(t, reader)
+			for _, name := range tt.want {
+				if _, ok := metrics[name]; !ok {
+					t.Errorf("%s not exported", name)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, ok := metrics[name]; ok {
+					t.Errorf("%s exported although turned off", name)
+				}
+			}
+		})
+	}
+
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	_, err := opensearch.NewShardCollector(context.Background(),
+		opensearch.WithConfig(opensearch.Config{DisabledMetrics: []string{"opensearch.shard.[store"}}),
+		opensearch.WithOpenSearchEndpoint(srv.URL),
+		opensearch.WithReader(sdkmetric.NewManualReader()),
+	)
+	if err == nil {
+		t.Error("NewShardCollector accepted a malformed metric pattern")
+	}
+}
+
+func TestViewsDontReenableDisabledMetrics(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"})
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{DisabledMetrics: []string{"opensearch.shard.docs.count"}}),
+		opensearch.WithIndices("logs"),
+		opensearch.WithView(
+			sdkmetric.NewView(
+				sdkmetric.Instrument{Name: "opensearch.shard.*"},
+				sdkmetric.Stream{Description: "From a view"},
+			),
+			sdkmetric.NewView(
+				sdkmetric.Instrument{Name: "opensearch.shard.docs.count"},
+				sdkmetric.Stream{Name: "shard_documents"},
+			),
+		),
+	)
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	metrics := collect(t, reader)
+	for _, name := range []string{"opensearch.shard.docs.count", "shard_documents"} {
+		if _, ok := metrics[name]; ok {
+			t.Errorf("%s exported although opensearch.shard.docs.count is disabled", name)
+		}
+	}
+	// Views still apply to the metrics that are enabled.
+	if got := metrics["opensearch.shard.store.size"].Description; got != "From a view" {
+		t.Errorf("opensearch.shard.store.size description = %q, want the view's", got)
+	}
+}
+
+func TestMissingIndexIsCountedAndSkipped(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1"})
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs", "deleted"))
+
+	for i := 0; i < 2; i++ {
+		shards, err := c.CollectOnce(context.Background())
+		if err != nil {
+			t.Fatalf("CollectOnce: %v", err)
+		}
+		if len(shards) != 1 || shards[0].Index != "logs" {
+			t.Fatalf("CollectOnce = %+v, want the shard of logs", shards)
+		}
+	}
+
+	metrics := collect(t, reader)
+	assertPoints(t, metrics, "opensearch.collector.index.missing", map[string]int64{"index=deleted": 2})
+	assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{
+		"index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED": 1,
+	})
+	if _, ok := metrics["opensearch.collector.scrape.errors"]; ok {
+		t.Error("missing index counted as a scrape error")
+	}
+}
+
+func TestShardIPAttributeIsNormalized(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", IP: " 10.0.0.1,10.0.0.9 ", Node: "node-1"},
+		opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED"},
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"))
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	assertPoints(t, collect(t, reader), "opensearch.shard.state", map[string]int64{
+		"index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED": 1,
+		"index=logs,ip=_unassigned,node=,prirep=r,shard=0,state=UNASSIGNED": 1,
+	})
+}
+
+func TestIndexFullyAllocated(t *testing.T) {
+	started := func(shard, prirep, node string) opensearch.ShardInfo {
+		return opensearch.ShardInfo{Shard: shard, Prirep: prirep, State: "STARTED", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: node}
+	}
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("healthy", started("0", "p", "node-1"), started("0", "r", "node-2"), started("1", "p", "node-2"), started("1", "r", "node-1"))
+	srv.SetShards("unassigned", started("0", "p", "node-1"), opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "UNASSIGNED", UnassignedReason: "NODE_LEFT"})
+	srv.SetShards("initializing", started("0", "p", "node-1"), opensearch.ShardInfo{Shard: "0", Prirep: "r", State: "INITIALIZING", IP: "10.0.0.2", Node: "node-2"})
+	srv.SetShards("relocating",
+		opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "RELOCATING", Docs: "1", Store: "1kb", IP: "10.0.0.1", Node: "node-1 -> 10.0.0.3 abc123 node-3"},
+		started("0", "r", "node-2"),
+	)
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("healthy", "unassigned", "initializing", "relocating"))
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+
+	assertPoints(t, collect(t, reader), "opensearch.index.fully_allocated", map[string]int64{
+		"index=healthy":      1,
+		"index=unassigned":   0,
+		"index=initializing": 0,
+		"index=relocating":   0,
+	})
+
+	// The index recovers once its replica is allocated.
+	srv.SetShards("unassigned", started("0", "p", "node-1"), started("0", "r", "node-2"))
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce: %v", err)
+	}
+	if got := points[int64](t, collect(t, reader), "opensearch.index.fully_allocated")["index=unassigned"]; got != 1 {
+		t.Errorf("fully_allocated for the recovered index = %d, want 1", got)
+	}
+}
+
+func TestIndexDocsDeleted(t *testing.T) {
+	withColumn := []opensearch.ShardInfo{
+		{Shard: "0", Prirep: "p", State: "STARTED", Docs: "10", DocsDeleted: "3", Store: "1kb", Node: "node-1"},
+		{Shard: "1", Prirep: "p", State: "STARTED", Docs: "20", DocsDeleted: "4", Store: "1kb", Node: "node-2"},
+		{Shard: "0", Prirep: "r", State: "STARTED", Docs: "10", DocsDeleted: "5", Store: "1kb", Node: "node-2"},
+		{Shard: "1", Prirep: "r", State: "UNASSIGNED"},
+	}
+	withoutColumn := []opensearch.ShardInfo{
+		{Shard: "0", Prirep: "p", State: "STARTED", Docs: "10", Store: "1kb", Node: "node-1"},
+	}
+	const stats = `{"indices":{"logs":{"primaries":{"docs":{"count":12,"deleted":9}}}}}`
+
+	tests := []struct {
+		name        string
+		shards      []opensearch.ShardInfo
+		statsStatus int
+		docsStats   bool
+		wantDeleted map[string]int64
+		wantCount   map[string]int64
+		wantStats   bool
+		wantErrors  map[string]int64
+	}{
+		{
+			name:        "column sums the primaries",
+			shards:      withColumn,
+			wantDeleted: map[string]int64{"index=logs": 7},
+		},
+		{
+			name:        "missing column falls back to _stats",
+			shards:      withoutColumn,
+			statsStatus: http.StatusOK,
+			wantDeleted: map[string]int64{"index=logs": 9},
+			wantStats:   true,
+		},
+		{
+			name:        "failed fallback reports nothing",
+			shards:      withoutColumn,
+			statsStatus: http.StatusInternalServerError,
+			wantStats:   true,
+			wantErrors:  map[string]int64{"reason=status": 1},
+		},
+		{
+			name:        "DocsStats takes both counts from _stats",
+			shards:      withColumn,
+			statsStatus: http.StatusOK,
+			docsStats:   true,
+			wantDeleted: map[string]int64{"index=logs": 9},
+			wantCount:   map[string]int64{"index=logs": 12},
+			wantStats:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := opensearchtest.NewServer()
+			defer srv.Close()
+			srv.SetShards("logs", tt.shards...)
+			if tt.statsStatus != 0 {
+				srv.SetResponse("/logs/_stats/docs", tt.statsStatus, stats)
+			}
+			c, reader := newTestCollector(t, srv,
+				opensearch.WithConfig(opensearch.Config{DocsStats: tt.docsStats, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}),
+				opensearch.WithIndices("logs"),
+			)
+
+			if _, err := c.CollectOnce(context.Background()); err != nil {
+				t.Fatalf("CollectOnce: %v", err)
+			}
+
+			metrics := collect(t, reader)
+			assertPoints(t, metrics, "opensearch.index.docs.deleted", tt.wantDeleted)
+			assertPoints(t, metrics, "opensearch.index.docs.count", tt.wantCount)
+			assertPoints(t, metrics, "opensearch.collector.scrape.errors", tt.wantErrors)
+			if got := lastRequest(srv, "/logs/_stats") != ""; got != tt.wantStats {
+				t.Errorf("requested _stats = %v, want %v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestCollectOnceResponseTooLarge(t *testing.T) {
+	const primary = "index=logs,ip=10.0.0.1,node=node-1,prirep=p,shard=0,state=STARTED"
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", DocsDeleted: "0", Store: "1kb", IP: "10.0.0.1", Node: "node-1"})
+	c, reader := newTestCollector(t, srv,
+		opensearch.WithConfig(opensearch.Config{MaxResponseBytes: 1 << 10}),
+		opensearch.WithIndices("logs"),
+	)
+
+	if _, err := c.CollectOnce(context.Background()); err != nil {
+		t.Fatalf("CollectOnce under the limit: %v", err)
+	}
+
+	// A response over the limit fails the scrape and keeps the shards of the
+	// previous one rather than any of the oversized response.
+	shards := make([]opensearch.ShardInfo, 0, 50)
+	for i := range 50 {
+		shards = append(shards, opensearch.ShardInfo{Shard: strconv.Itoa(i + 1), Prirep: "p", State: "STARTED", Docs: "1", DocsDeleted: "0", Store: "1kb", IP: "10.0.0.1", Node: "node-1"})
+	}
+	srv.SetShards("logs", shards...)
+	for _, gzip := range []bool{false, true} {
+		srv.SetGzip(gzip)
+		got, err := c.CollectOnce(context.Background())
+		if !errors.Is(err, opensearch.ErrResponseTooLarge) {
+			t.Fatalf("CollectOnce with gzip %t: error = %v, want ErrResponseTooLarge", gzip, err)
+		}
+		if got != nil {
+			t.Errorf("CollectOnce with gzip %t returned %d shards, want none", gzip, len(got))
+		}
+		metrics := collect(t, reader)
+		assertPoints(t, metrics, "opensearch.shard.state", map[string]int64{primary: 1})
+	}
+}
+
+func TestShardStateAgeFollowsAllocation(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+	c, reader := newTestCollector(t, srv, opensearch.WithIndices("logs"), opensearch.WithClock(clock))
+
+	primary := opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", DocsDeleted: "0", Store: "1kb", IP: "10.0.0.1", Node: "node-1"}
+	replica := opensearch.ShardInfo{Shard: "0", Prirep: "r"}
+	steps := []struct {
+		state, node, want string
+		age               float64
+	}{
+		{state: "UNASSIGNED", want: "index=logs,node=_unassigned,prirep=r,shard=0,state=UNASSIGNED"},
+		{state: "INITIALIZING", node: "node-2", want: "index=logs,node=node-2,prirep=r,shard=0,state=INITIALIZING", age: 60},
+		{state: "RELOCATING", node: "node-2 -> 10.0.0.3 id node-3", want: "index=logs,node=node-2,prirep=r,shard=0,state=RELOCATING", age: 120},
+	}
+	// The replica is allocated and then moved. Its age counts from when it
+	// first went pending rather than restarting with each state or node.
+	for _, step := range steps {
+		replica.State, replica.Node = step.state, step.node
+		srv.SetShards("logs", primary, replica)
+		if err := c.CollectMetrics(context.Background()); err != nil {
+			t.Fatalf("%s: CollectMetrics: %v", step.state, err)
+		}
+		assertPoints(t, collect(t, reader), "opensearch.shard.state.age.seconds", map[string]float64{step.want: step.age})
+		clock.Advance(time.Minute)
+	}
+
+	replica.State, replica.Node = "STARTED", "node-3"
+	srv.SetShards("logs", primary, replica)
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("STARTED: CollectMetrics: %v", err)
+	}
+	assertPoints(t, collect(t, reader), "opensearch.shard.state.age.seconds", map[string]float64{})
+}
+
+func TestCompanionsForTwoClusters(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	// Each cluster's companions record under their own scopes, so the two
+	// clusters' series stay apart in one provider.
+	clusters := map[string]struct {
+		status      string
+		tasks       string
+		wantStatus  int64
+		wantPending int64
+	}{
+		"prod":    {status: "yellow", tasks: `{"tasks":[{"time_in_queue_millis":5},{"time_in_queue_millis":9}]}`, wantStatus: 1, wantPending: 2},
+		"staging": {status: "green", tasks: `{}`, wantStatus: 0, wantPending: 0},
+	}
+	for name, cluster := range clusters {
+		srv := opensearchtest.NewServer()
+		defer srv.Close()
+		srv.SetClusterHealth(opensearch.ClusterHealth{ClusterName: name, Status: cluster.status, NumberOfNodes: 3})
+		srv.SetResponse("/_cluster/pending_tasks", http.StatusOK, cluster.tasks)
+
+		health, err := opensearch.NewClusterHealthCollector(srv.URL, provider, opensearch.Config{},
+			opensearch.WithCompanionMeterName("opensearch.cluster."+name))
+		if err != nil {
+			t.Fatalf("%s: NewClusterHealthCollector: %v", name, err)
+		}
+		defer health.Shutdown(context.Background())
+		pending, err := opensearch.NewPendingTasksCollector(srv.URL, provider, opensearch.Config{},
+			opensearch.WithCompanionMeterName("opensearch.cluster.pending_tasks."+name))
+		if err != nil {
+			t.Fatalf("%s: NewPendingTasksCollector: %v", name, err)
+		}
+		defer pending.Shutdown(context.Background())
+
+		if err := health.CollectMetrics(context.Background()); err != nil {
+			t.Fatalf("%s: health CollectMetrics: %v", name, err)
+		}
+		if err := pending.CollectMetrics(context.Background()); err != nil {
+			t.Fatalf("%s: pending tasks CollectMetrics: %v", name, err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	values := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range gauge.DataPoints {
+				values[scope.Scope.Name+" "+m.Name] += dp.Value
+			}
+		}
+	}
+	for name, cluster := range clusters {
+		for key, want := range map[string]int64{
+			"opensearch.cluster." + name + " opensearch.cluster.status":                      cluster.wantStatus,
+			"opensearch.cluster." + name + " opensearch.cluster.number_of_nodes":             3,
+			"opensearch.cluster.pending_tasks." + name + " opensearch.cluster.pending_tasks": cluster.wantPending,
+		} {
+			if got, ok := values[key]; !ok || got != want {
+				t.Errorf("%s = %d (present %t), want %d", key, got, ok, want)
+			}
+		}
+	}
+}
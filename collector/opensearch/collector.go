@@ -0,0 +1,27 @@
+package opensearch
+
+import "context"
+
+// Collector is a source of metrics driven by a Runner. ShardCollector and
+// the companion collectors in this package implement it, and other packages
+// may add their own.
+//
+// A Collector registers its instruments when it is created, against the
+// MeterProvider it was given, typically Runner.MeterProvider. Observable
+// instruments should report the state saved by the latest CollectMetrics.
+type Collector interface {
+	// CollectMetrics fetches fresh data and records it. It is called once
+	// per scrape interval and should respect ctx's deadline.
+	CollectMetrics(ctx context.Context) error
+	// Shutdown unregisters the collector's callbacks and releases anything
+	// it owns.
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	_ Collector = (*ShardCollector)(nil)
+	_ Collector = (*ClusterHealthCollector)(nil)
+	_ Collector = (*NodeStatsCollector)(nil)
+	_ Collector = (*IndexRateCollector)(nil)
+	_ Collector = (*PendingTasksCollector)(nil)
+)
@@ -0,0 +1,561 @@
+package opensearch
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	DefaultScrapeInterval = 1 * time.Minute
+	DefaultExportInterval = 10 * time.Second
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultScrapeTimeout  = 30 * time.Second
+	DefaultConcurrency    = 4
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultFlushTimeout   = 5 * time.Second
+
+	DefaultMaxResponseBytes = 256 << 20
+
+	// NoRequestTimeout disables the client-level timeout of OpenSearch
+	// requests when used as Config.RequestTimeout.
+	NoRequestTimeout time.Duration = -1
+
+	DefaultAliasRefreshInterval = 5 * time.Minute
+
+	DefaultOTLPTimeout              = 10 * time.Second
+	DefaultOTLPRetryInitialInterval = 5 * time.Second
+	DefaultOTLPRetryMaxInterval     = 30 * time.Second
+	DefaultOTLPRetryMaxElapsedTime  = time.Minute
+	DefaultOTLPKeepaliveTimeout     = 20 * time.Second
+
+	DefaultServiceName = "opensearch-shard-collector"
+)
+
+// Config holds the tunables for a ShardCollector. Zero values fall back to
+// the package defaults.
+type Config struct {
+	// ScrapeInterval is how often shard information is fetched from OpenSearch.
+	ScrapeInterval time.Duration
+	// ScrapeTimeout bounds a whole scrape cycle, across all of its requests
+	// and retries. It must be shorter than ScrapeInterval and defaults to
+	// DefaultScrapeTimeout, or half the scrape interval if that is shorter.
+	ScrapeTimeout time.Duration
+	// ScrapeJitter is the maximum random delay added to each scrape after its
+	// tick, so agents started together don't hit the cluster at the same
+	// instant. The ticks themselves stay on ScrapeInterval, so the scrape
+	// frequency is unchanged. It must be shorter than ScrapeInterval minus
+	// ScrapeTimeout; zero disables jitter.
+	ScrapeJitter time.Duration
+	// BreakerThreshold opens a circuit breaker after this many consecutive
+	// failed shard scrapes, so a Runner stops hammering a cluster that is
+	// down. While open, the Runner probes with a single scrape at growing
+	// intervals, up to BreakerMaxInterval, and resumes the normal interval
+	// after the first success. Zero, the default, disables the breaker.
+	BreakerThreshold int
+	// BreakerMaxInterval is the longest wait between probes while the
+	// breaker is open. It defaults to ten scrape intervals.
+	BreakerMaxInterval time.Duration
+	// ExportInterval is how often the periodic reader pushes metrics to the collector.
+	ExportInterval time.Duration
+	// FlushTimeout bounds the final export performed by Shutdown, and each
+	// ForceFlush, so an unreachable collector can't hold up termination. It
+	// defaults to DefaultFlushTimeout.
+	FlushTimeout time.Duration
+	// FlushAfterCollect makes the Runner export right after every
+	// collection instead of waiting for the next ExportInterval tick. The
+	// periodic export keeps its own schedule, so with an ExportInterval
+	// shorter than the ScrapeInterval the same values are pushed more than
+	// once. It has no effect on the Prometheus endpoint, which is pulled.
+	FlushAfterCollect bool
+	// Indices lists the indices or index patterns (e.g. "otlp-*") whose
+	// shards are collected. An empty list collects shards for all indices.
+	Indices []string
+	// Aliases are resolved to the indices they point to, through _alias,
+	// and those indices are collected along with Indices. When Aliases is
+	// set an empty Indices no longer means every index, so an alias that
+	// resolves to nothing collects nothing.
+	Aliases []string
+	// AliasRefreshInterval is how long a resolution of Aliases is reused
+	// before it is looked up again, to follow rollovers. It defaults to
+	// DefaultAliasRefreshInterval.
+	AliasRefreshInterval time.Duration
+	// Concurrency is the maximum number of indices fetched in parallel. It
+	// defaults to DefaultConcurrency.
+	Concurrency int
+	// IncludeHidden includes hidden and system indices (those starting with a
+	// dot) when expanding patterns or collecting all indices. Indices named
+	// explicitly are always collected.
+	IncludeHidden bool
+	// IncludeRegex and ExcludeRegex filter the indices returned by
+	// OpenSearch, after patterns in Indices have been expanded. Patterns are
+	// unanchored Go regular expressions; an index matching ExcludeRegex is
+	// skipped even if it also matches IncludeRegex.
+	IncludeRegex string
+	ExcludeRegex string
+	// IncludeStates, when set, limits collection to shards in one of these
+	// states. ExcludeStates drops shards in any of its states. Both are
+	// matched case-insensitively against the state column, e.g. "UNASSIGNED".
+	IncludeStates []string
+	ExcludeStates []string
+	// Nodes, when set, limits collection to shards allocated to these nodes,
+	// matched against the node name or IP, for running one agent per node.
+	// LocalNode adds the node serving the OpenSearch endpoint, found through
+	// _nodes/_local, so the endpoint should point at that node rather than a
+	// load balancer. With either set, unassigned shards are not collected.
+	Nodes     []string
+	LocalNode bool
+	// ObserveStates limits the per-shard metrics (state, store size and
+	// docs count) to shards in these states, e.g. only STARTED for size
+	// dashboards. Unlike IncludeStates and ExcludeStates, filtered shards
+	// still count towards the index, node and unassigned aggregates. Empty
+	// observes every state.
+	ObserveStates []string
+	// EnabledMetrics, when set, limits the exported metrics to those named,
+	// and DisabledMetrics drops metrics. Names may contain * wildcards, such
+	// as "opensearch.shard.*", and are matched against instrument names
+	// before any WithView rename. They apply to every collector sharing the
+	// MeterProvider and take precedence over views, which can't export a
+	// dropped metric again. Callbacks observing only dropped metrics don't
+	// run.
+	EnabledMetrics  []string
+	DisabledMetrics []string
+	// ShardsByRole exports opensearch.index.shards.by_role, which adds up to
+	// eight series per index (two roles in four states). It is off by
+	// default.
+	ShardsByRole bool
+	// SegmentsCount also requests the segments.count column, which is
+	// needed for opensearch.shard.segments.count.
+	SegmentsCount bool
+	// MemoryColumns also requests the completion.size, fielddata.memory_size
+	// and segments.memory columns and exports each as a per-shard gauge. It
+	// is off by default to keep responses small.
+	MemoryColumns bool
+	// StoreUnit scales the exported store sizes and sets their unit. It
+	// defaults to StoreUnitBytes.
+	StoreUnit StoreUnit
+	// MinStoreBytes hides shards smaller than this many bytes from
+	// opensearch.shard.store.size, to keep tiny shards off dashboards. It
+	// only affects that series: the shards are still counted, and still
+	// contribute to the document, index and node totals.
+	MinStoreBytes int64
+	// SizeSource selects where the index store sizes, primary and total,
+	// come from. It defaults to SizeSourceCat; SizeSourceStats is exact.
+	// Per-shard and per-node sizes always come from _cat/shards.
+	SizeSource SizeSource
+	// DocsStats fetches the live and deleted document counts of each
+	// index's primaries from _stats, one more request per scrape, and
+	// exports them as opensearch.index.docs.count and
+	// opensearch.index.docs.deleted. Without it the deleted counts are still
+	// exported, summed from the docs.deleted column of _cat/shards or, when
+	// the cluster doesn't report that column, fetched from _stats.
+	DocsStats bool
+	// AttributeMode selects the attributes of the per-shard metrics. It
+	// defaults to AttributeModeFull; see AttributeMode for the cardinality
+	// of each mode.
+	AttributeMode AttributeMode
+	// RawBytes asks OpenSearch for store sizes in plain bytes (bytes=b) and
+	// parses them without unit conversion. When it is false, or a value still
+	// carries a unit, the human readable size is converted instead.
+	RawBytes bool
+	// Username and Password enable HTTP basic authentication against
+	// OpenSearch. Requests are unauthenticated when Username is empty.
+	Username string
+	Password string
+	// APIKey and BearerToken authenticate with an Authorization header of
+	// the form "ApiKey <key>" or "Bearer <token>". At most one of Username,
+	// APIKey and BearerToken may be set.
+	APIKey      string
+	BearerToken string
+	// TokenProvider supplies short-lived bearer tokens, refreshed on expiry
+	// and whenever OpenSearch answers 401. It replaces BearerToken for
+	// tokens that rotate.
+	TokenProvider TokenProvider
+	// MaxRetries is how many times a failed OpenSearch request is retried.
+	// Connection errors and 5xx responses are retried, 4xx responses are not.
+	MaxRetries int
+	// RetryBaseDelay is the initial backoff between retries. It doubles with
+	// every attempt and is jittered.
+	RetryBaseDelay time.Duration
+	// TLS configures HTTPS connections to OpenSearch.
+	TLS TLSConfig
+	// RequestTimeout bounds each HTTP request to OpenSearch, separately from
+	// the ScrapeTimeout of the whole cycle. It defaults to
+	// DefaultRequestTimeout; NoRequestTimeout disables the client-level
+	// timeout so only ScrapeTimeout applies.
+	RequestTimeout time.Duration
+	// MaxResponseBytes caps the size of a decoded OpenSearch response, after
+	// decompression, so a pattern matching far more shards than expected
+	// fails the scrape with ErrResponseTooLarge instead of exhausting
+	// memory. It defaults to DefaultMaxResponseBytes.
+	MaxResponseBytes int64
+	// ProxyURL routes OpenSearch requests through this proxy. Hosts listed
+	// in NO_PROXY still connect directly. When it is empty the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables apply.
+	ProxyURL string
+	// Headers are added to every OpenSearch request, for example the
+	// securitytenant header of the Security plugin. Headers the client sets
+	// itself, such as Authorization, can't be overridden.
+	Headers map[string]string
+	// UserAgent identifies the agent in OpenSearch audit and access logs. It
+	// defaults to "instrumentation-exporter-agent/" followed by the build
+	// Version.
+	UserAgent string
+	// ExporterType selects the metric exporter. The zero value keeps the
+	// OTLP gRPC exporter (ExporterOTLP). The OTLP endpoint and TLS settings
+	// apply to both ExporterOTLP and ExporterOTLPHTTP.
+	ExporterType ExporterType
+	// PrometheusListenAddr serves a Prometheus /metrics endpoint on this
+	// address. With ExporterOTLP the endpoint is served in addition to the
+	// OTLP push and is disabled when empty; with ExporterPrometheus it
+	// defaults to DefaultPrometheusListenAddr.
+	PrometheusListenAddr string
+	// Temporality selects cumulative or delta temporality for pushed
+	// counters and histograms. It defaults to TemporalityCumulative.
+	Temporality Temporality
+	// OTLPSecure exports metrics and traces over TLS, as configured by
+	// OTLPTLS. It is off by default, so the zero Config exports over a
+	// plaintext connection.
+	OTLPSecure bool
+	// OTLPTLS configures the TLS connection to the OTLP collector when
+	// OTLPSecure is set.
+	OTLPTLS TLSConfig
+	// OTLPHeaders are sent with every OTLP export, metrics and traces, for
+	// example an authorization header required by a hosted collector. They
+	// are independent of OTLPTLS.
+	OTLPHeaders map[string]string
+	// OTLPTimeout bounds a single export request, including its retries. It
+	// defaults to DefaultOTLPTimeout.
+	OTLPTimeout time.Duration
+	// OTLPRetry controls how failed exports are retried while the collector
+	// is unavailable.
+	OTLPRetry OTLPRetryConfig
+	// OTLPKeepalive pings the collector over idle gRPC connections of the
+	// metric and trace exporters. It is off by default.
+	OTLPKeepalive OTLPKeepaliveConfig
+	// Tracing exports a span for every scrape cycle to the OTLP endpoint,
+	// with the index and shard counts as attributes. It requires an OTLP
+	// exporter and is off by default, in which case spans cost nothing.
+	Tracing bool
+	// ServiceName and ServiceVersion identify this agent in the exported
+	// resource. They default to DefaultServiceName and the build Version.
+	ServiceName    string
+	ServiceVersion string
+	// ResourceAttributes are extra attributes, such as a cluster label,
+	// merged into the exported resource.
+	ResourceAttributes map[string]string
+	// Logger receives warnings about skipped shards and background failures.
+	// It defaults to slog.Default().
+	Logger *slog.Logger
+	// Clock supplies the time used for state ages, rates, token expiry and
+	// the Runner's ticker. It defaults to the system clock.
+	Clock Clock
+}
+
+// WithDefaults returns c with every unset field that has a default filled
+// in, as the collectors see it.
+func (c Config) WithDefaults() Config {
+	return c.withDefaults()
+}
+
+func (c Config) withDefaults() Config {
+	if c.ScrapeInterval == 0 {
+		c.ScrapeInterval = DefaultScrapeInterval
+	}
+	if c.ScrapeTimeout == 0 {
+		c.ScrapeTimeout = min(DefaultScrapeTimeout, c.ScrapeInterval/2)
+	}
+	if c.BreakerMaxInterval == 0 {
+		c.BreakerMaxInterval = 10 * c.ScrapeInterval
+	}
+	if c.ExportInterval == 0 {
+		c.ExportInterval = DefaultExportInterval
+	}
+	if c.FlushTimeout == 0 {
+		c.FlushTimeout = DefaultFlushTimeout
+	}
+	if c.OTLPTimeout == 0 {
+		c.OTLPTimeout = DefaultOTLPTimeout
+	}
+	c.OTLPRetry = c.OTLPRetry.withDefaults()
+	c.OTLPKeepalive = c.OTLPKeepalive.withDefaults()
+	if c.ServiceName == "" {
+		c.ServiceName = DefaultServiceName
+	}
+	if c.ServiceVersion == "" {
+		c.ServiceVersion = Version
+	}
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+	if c.Clock == nil {
+		c.Clock = realClock{}
+	}
+	if c.ExporterType == "" {
+		c.ExporterType = ExporterOTLP
+	}
+	if c.SizeSource == "" {
+		c.SizeSource = SizeSourceCat
+	}
+	if c.UserAgent == "" {
+		c.UserAgent = "instrumentation-exporter-agent/" + Version
+	}
+	if c.StoreUnit == "" {
+		c.StoreUnit = StoreUnitBytes
+	}
+	if c.AttributeMode == "" {
+		c.AttributeMode = AttributeModeFull
+	}
+	if c.Temporality == "" {
+		c.Temporality = TemporalityCumulative
+	}
+	if c.ExporterType == ExporterPrometheus && c.PrometheusListenAddr == "" {
+		c.PrometheusListenAddr = DefaultPrometheusListenAddr
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	if c.RequestTimeout == 0 {
+		c.RequestTimeout = DefaultRequestTimeout
+	}
+	if c.MaxResponseBytes == 0 {
+		c.MaxResponseBytes = DefaultMaxResponseBytes
+	}
+	if c.AliasRefreshInterval == 0 {
+		c.AliasRefreshInterval = DefaultAliasRefreshInterval
+	}
+	if c.RetryBaseDelay == 0 {
+		c.RetryBaseDelay = DefaultRetryBaseDelay
+	}
+	return c
+}
+
+func (c Config) validate() error {
+	if c.ScrapeInterval <= 0 {
+		return fmt.Errorf("scrape interval must be positive, got %s", c.ScrapeInterval)
+	}
+	if c.ScrapeTimeout <= 0 || c.ScrapeTimeout >= c.ScrapeInterval {
+		return fmt.Errorf("scrape timeout must be positive and shorter than the scrape interval %s, got %s", c.ScrapeInterval, c.ScrapeTimeout)
+	}
+	if c.ScrapeJitter < 0 || c.ScrapeJitter >= c.ScrapeInterval-c.ScrapeTimeout {
+		return fmt.Errorf("scrape jitter must be non-negative and shorter than the scrape interval minus the scrape timeout %s, got %s", c.ScrapeInterval-c.ScrapeTimeout, c.ScrapeJitter)
+	}
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker threshold must not be negative, got %d", c.BreakerThreshold)
+	}
+	if c.BreakerMaxInterval < c.ScrapeInterval {
+		return fmt.Errorf("breaker max interval must be at least the scrape interval %s, got %s", c.ScrapeInterval, c.BreakerMaxInterval)
+	}
+	if c.ExportInterval <= 0 {
+		return fmt.Errorf("export interval must be positive, got %s", c.ExportInterval)
+	}
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", c.Concurrency)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative, got %d", c.MaxRetries)
+	}
+	if c.RetryBaseDelay <= 0 {
+		return fmt.Errorf("retry base delay must be positive, got %s", c.RetryBaseDelay)
+	}
+	if err := c.validateAuth(); err != nil {
+		return err
+	}
+	if c.RequestTimeout < 0 && c.RequestTimeout != NoRequestTimeout {
+		return fmt.Errorf("request timeout must not be negative, got %s", c.RequestTimeout)
+	}
+	if c.MaxResponseBytes < 0 {
+		return fmt.Errorf("maximum response bytes must be positive, got %d", c.MaxResponseBytes)
+	}
+	if c.MinStoreBytes < 0 {
+		return fmt.Errorf("minimum store bytes must not be negative, got %d", c.MinStoreBytes)
+	}
+	if _, err := c.StoreUnit.divisor(); err != nil {
+		return err
+	}
+	if err := c.SizeSource.validate(); err != nil {
+		return err
+	}
+	if err := c.AttributeMode.validate(); err != nil {
+		return err
+	}
+	if _, err := temporalitySelector(c.Temporality); err != nil {
+		return err
+	}
+	if c.FlushTimeout <= 0 {
+		return fmt.Errorf("flush timeout must be positive, got %s", c.FlushTimeout)
+	}
+	if c.OTLPTimeout <= 0 {
+		return fmt.Errorf("OTLP timeout must be positive, got %s", c.OTLPTimeout)
+	}
+	if err := c.OTLPRetry.validate(); err != nil {
+		return err
+	}
+	if err := c.OTLPKeepalive.validate(); err != nil {
+		return err
+	}
+	for _, index := range c.Indices {
+		if err := validateIndexName(index); err != nil {
+			return err
+		}
+	}
+	for _, alias := range c.Aliases {
+		if err := validateIndexName(alias); err != nil {
+			return fmt.Errorf("invalid alias: %w", err)
+		}
+	}
+	if c.AliasRefreshInterval <= 0 {
+		return fmt.Errorf("alias refresh interval must be positive, got %s", c.AliasRefreshInterval)
+	}
+	for _, states := range [][]string{c.IncludeStates, c.ExcludeStates, c.ObserveStates} {
+		for _, state := range states {
+			if !knownShardState(state) {
+				return fmt.Errorf("unknown shard state %q", state)
+			}
+		}
+	}
+	if !httpguts.ValidHeaderFieldValue(c.UserAgent) {
+		return fmt.Errorf("invalid user agent %q", c.UserAgent)
+	}
+	for _, patterns := range [][]string{c.EnabledMetrics, c.DisabledMetrics} {
+		for _, pattern := range patterns {
+			if err := validateMetricPattern(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	for name, value := range c.Headers {
+		if err := validateHeader(name, value); err != nil {
+			return err
+		}
+	}
+	for name, value := range c.OTLPHeaders {
+		if err := validateOTLPHeader(name, value); err != nil {
+			return err
+		}
+	}
+	for key := range c.ResourceAttributes {
+		if err := validateResourceAttribute(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardStates are the values _cat/shards reports in its state column.
+var shardStates = []string{"STARTED", "INITIALIZING", "RELOCATING", "UNASSIGNED"}
+
+func knownShardState(state string) bool {
+	for _, known := range shardStates {
+		if strings.EqualFold(state, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedAttributes are keys the collectors set on data points or on the
+// resource themselves. Backends that flatten resource attributes into labels
+// would otherwise see two conflicting values.
+var reservedAttributes = map[string]bool{
+	"index":           true,
+	"shard":           true,
+	"prirep":          true,
+	"state":           true,
+	"node":            true,
+	"ip":              true,
+	"status":          true,
+	"reason":          true,
+	"field":           true,
+	"copy":            true,
+	"source_node":     true,
+	"target_node":     true,
+	"service.name":    true,
+	"service.version": true,
+}
+
+func validateResourceAttribute(key string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("resource attribute key must not be empty")
+	}
+	if reservedAttributes[key] {
+		return fmt.Errorf("resource attribute %q is reserved", key)
+	}
+	return nil
+}
+
+// managedHeaders are set by the client on every request; configuring them
+// as extra headers would break authentication or response decoding.
+var managedHeaders = map[string]bool{
+	"Accept":          true,
+	"Accept-Encoding": true,
+	"Authorization":   true,
+	"User-Agent":      true,
+}
+
+func validateHeader(name, value string) error {
+	if !httpguts.ValidHeaderFieldName(name) {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return fmt.Errorf("invalid value for header %q", name)
+	}
+	if managedHeaders[http.CanonicalHeaderKey(name)] {
+		return fmt.Errorf("header %q is set by the collector and can't be overridden", name)
+	}
+	return nil
+}
+
+// validateOTLPHeader checks an OTLP export header. Unlike Headers, any name
+// is allowed, including authorization.
+func validateOTLPHeader(name, value string) error {
+	if !httpguts.ValidHeaderFieldName(name) {
+		return fmt.Errorf("invalid OTLP header name %q", name)
+	}
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return fmt.Errorf("invalid value for OTLP header %q", name)
+	}
+	return nil
+}
+
+func (c Config) validateAuth() error {
+	var methods []string
+	if c.Username != "" {
+		methods = append(methods, "basic auth")
+	}
+	if c.APIKey != "" {
+		methods = append(methods, "API key")
+	}
+	if c.BearerToken != "" {
+		methods = append(methods, "bearer token")
+	}
+	if c.TokenProvider != nil {
+		methods = append(methods, "token provider")
+	}
+	if len(methods) > 1 {
+		return fmt.Errorf("only one OpenSearch auth method may be configured, got %s", strings.Join(methods, " and "))
+	}
+	return nil
+}
+
+// invalidIndexChars are characters that OpenSearch rejects in index names or
+// that would change the meaning of the request path.
+const invalidIndexChars = `\/?#"<>| ,`
+
+func validateIndexName(index string) error {
+	if index == "" {
+		return fmt.Errorf("index name must not be empty")
+	}
+	if i := strings.IndexAny(index, invalidIndexChars); i >= 0 {
+		return fmt.Errorf("index name %q contains invalid character %q", index, index[i])
+	}
+	return nil
+}
+
+func isIndexPattern(index string) bool {
+	return strings.Contains(index, "*")
+}
@@ -0,0 +1,83 @@
+package opensearch
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// docsStatsQuery trims the _stats response to the primary document counts
+// and skips configured indices that don't exist.
+const docsStatsQuery = "ignore_unavailable=true&filter_path=indices.*.primaries.docs"
+
+// indexDocsStats are the document counts of an index's primaries, as
+// reported by _stats.
+type indexDocsStats struct {
+	Primaries struct {
+		Docs struct {
+			Count   int64 `json:"count"`
+			Deleted int64 `json:"deleted"`
+		} `json:"docs"`
+	} `json:"primaries"`
+}
+
+// fetchDocsStats fetches the live and deleted document counts of the
+// configured indices.
+func (c *ShardCollector) fetchDocsStats(ctx context.Context) (map[string]indexDocsStats, error) {
+	var resp struct {
+		Indices map[string]indexDocsStats `json:"indices"`
+	}
+	if err := c.getIndexStats(ctx, "docs", docsStatsQuery, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Indices, nil
+}
+
+// applyDocsStats sets the document counts of the indices in s. Indices
+// missing from stats, such as ones created since, report no counts.
+func (s snapshot) applyDocsStats(stats map[string]indexDocsStats) {
+	for name, index := range s.indices {
+		if st, ok := stats[name]; ok {
+			index.docs = st.Primaries.Docs.Count
+			index.docsDeleted = st.Primaries.Docs.Deleted
+			index.hasDocsStats = true
+		}
+	}
+}
+
+// applyDeletedDocs sets only the deleted document counts of the indices in s,
+// leaving the live counts to Config.DocsStats.
+func (s snapshot) applyDeletedDocs(stats map[string]indexDocsStats) {
+	for name, index := range s.indices {
+		if st, ok := stats[name]; ok {
+			index.docsDeleted = st.Primaries.Docs.Deleted
+			index.hasDeleted = true
+		}
+	}
+}
+
+// missingDocsDeleted reports whether a shard with a document count didn't
+// report the docs.deleted column, so the cluster doesn't have it.
+func missingDocsDeleted(samples []shardSample) bool {
+	for _, sample := range samples {
+		if sample.hasDocs && strings.TrimSpace(sample.DocsDeleted) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fallBackToDeletedDocsStats fills in the deleted document counts of snap
+// from _stats. A failure is logged and counted but doesn't fail the scrape,
+// which then reports no deleted documents.
+func (c *ShardCollector) fallBackToDeletedDocsStats(ctx context.Context, snap snapshot) {
+	stats, err := c.fetchDocsStats(ctx)
+	if err != nil {
+		c.cfg.Logger.Warn("Failed to fetch deleted document counts", "error", err)
+		c.scrapeErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", errorReason(err))))
+		return
+	}
+	snap.applyDeletedDocs(stats)
+}
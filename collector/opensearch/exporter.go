@@ -0,0 +1,325 @@
+package opensearch
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ExporterType selects how metrics leave the agent.
+type ExporterType string
+
+const (
+	// ExporterOTLP pushes metrics to an OTLP collector over gRPC. It is the
+	// default when ExporterType is left empty.
+	ExporterOTLP ExporterType = "otlp"
+	// ExporterOTLPHTTP pushes metrics to an OTLP collector over HTTP.
+	ExporterOTLPHTTP ExporterType = "otlphttp"
+	// ExporterStdout prints metrics to standard output on every export
+	// interval. It is meant for local debugging.
+	ExporterStdout ExporterType = "stdout"
+	// ExporterPrometheus serves metrics on a Prometheus /metrics endpoint
+	// instead of pushing them.
+	ExporterPrometheus ExporterType = "prometheus"
+)
+
+const DefaultPrometheusListenAddr = ":9464"
+
+// Temporality selects how pushed counters and histograms are aggregated over
+// time.
+type Temporality string
+
+const (
+	// TemporalityCumulative reports totals since the agent started. It is
+	// the default, survives dropped exports and is what Prometheus-style
+	// backends expect, but a restart shows up as a reset.
+	TemporalityCumulative Temporality = "cumulative"
+	// TemporalityDelta reports only the change since the previous export.
+	// Backends such as Datadog or Dynatrace prefer it and it keeps less
+	// state in the agent, but an export that is dropped loses its values.
+	TemporalityDelta Temporality = "delta"
+)
+
+// temporalitySelector returns the selector for t. Up-down counters stay
+// cumulative under delta, as delta sums of them are rarely useful. The
+// Prometheus endpoint is always cumulative.
+func temporalitySelector(t Temporality) (sdkmetric.TemporalitySelector, error) {
+	switch t {
+	case TemporalityCumulative:
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case TemporalityDelta:
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			default:
+				return metricdata.DeltaTemporality
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown temporality %q", t)
+	}
+}
+
+// OTLPRetryConfig controls retries of failed OTLP exports. Retries back off
+// exponentially from InitialInterval up to MaxInterval and stop after
+// MaxElapsedTime, at which point the batch is dropped and the next export
+// interval tries again. Zero durations fall back to the package defaults.
+type OTLPRetryConfig struct {
+	// Disabled turns retries off, so a failed export is dropped immediately.
+	Disabled        bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}
+
+func (r OTLPRetryConfig) withDefaults() OTLPRetryConfig {
+	if r.InitialInterval == 0 {
+		r.InitialInterval = DefaultOTLPRetryInitialInterval
+	}
+	if r.MaxInterval == 0 {
+		r.MaxInterval = DefaultOTLPRetryMaxInterval
+	}
+	if r.MaxElapsedTime == 0 {
+		r.MaxElapsedTime = DefaultOTLPRetryMaxElapsedTime
+	}
+	return r
+}
+
+func (r OTLPRetryConfig) validate() error {
+	if r.InitialInterval < 0 || r.MaxInterval < 0 || r.MaxElapsedTime < 0 {
+		return fmt.Errorf("OTLP retry intervals must not be negative")
+	}
+	if r.InitialInterval > r.MaxInterval {
+		return fmt.Errorf("OTLP retry initial interval %s exceeds max interval %s", r.InitialInterval, r.MaxInterval)
+	}
+	return nil
+}
+
+// OTLPKeepaliveConfig makes the gRPC exporter ping an idle connection to the
+// collector, so a connection silently dropped by a load balancer or NAT is
+// noticed and re-dialed before the next export instead of failing it. It is
+// off while Time is zero and doesn't apply to ExporterOTLPHTTP.
+type OTLPKeepaliveConfig struct {
+	// Time is how long the connection may be idle before a ping; gRPC
+	// raises it to at least 10s. The collector has to permit pings this
+	// often without active calls, or it closes the connection.
+	Time time.Duration
+	// Timeout is how long to wait for a ping to be acknowledged before the
+	// connection is closed. It defaults to DefaultOTLPKeepaliveTimeout.
+	Timeout time.Duration
+}
+
+func (k OTLPKeepaliveConfig) withDefaults() OTLPKeepaliveConfig {
+	if k.Timeout == 0 {
+		k.Timeout = DefaultOTLPKeepaliveTimeout
+	}
+	return k
+}
+
+func (k OTLPKeepaliveConfig) validate() error {
+	if k.Time < 0 || k.Timeout < 0 {
+		return fmt.Errorf("OTLP keepalive time and timeout must not be negative")
+	}
+	return nil
+}
+
+// dialOption returns the gRPC dial option that turns keepalive on, or nil
+// when it is off.
+func (k OTLPKeepaliveConfig) dialOption() grpc.DialOption {
+	if k.Time <= 0 {
+		return nil
+	}
+	// Exports are short unary calls, so without PermitWithoutStream no pings
+	// would be sent between them.
+	return grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:                k.Time,
+		Timeout:             k.Timeout,
+		PermitWithoutStream: true,
+	})
+}
+
+// readers holds the metric readers for the configured exporters, plus the
+// registry backing the Prometheus endpoint when one is served.
+type readers struct {
+	readers      []sdkmetric.Reader
+	promRegistry *prometheus.Registry
+}
+
+func newReaders(ctx context.Context, cfg Config, collectorEndpoint string) (*readers, error) {
+	r := &readers{}
+
+	temporality, err := temporalitySelector(cfg.Temporality)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.ExporterType {
+	case ExporterOTLP, ExporterOTLPHTTP:
+		exporter, err := newOTLPExporter(ctx, cfg, collectorEndpoint, temporality)
+		if err != nil {
+			return nil, err
+		}
+		r.readers = append(r.readers, sdkmetric.NewPeriodicReader(
+			exporter,
+			sdkmetric.WithInterval(cfg.ExportInterval),
+		))
+	case ExporterStdout:
+		exporter, err := stdoutmetric.New(
+			stdoutmetric.WithPrettyPrint(),
+			stdoutmetric.WithTemporalitySelector(temporality),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		r.readers = append(r.readers, sdkmetric.NewPeriodicReader(
+			exporter,
+			sdkmetric.WithInterval(cfg.ExportInterval),
+		))
+	case ExporterPrometheus:
+	default:
+		return nil, fmt.Errorf("unknown exporter type %q", cfg.ExporterType)
+	}
+
+	if cfg.PrometheusListenAddr != "" {
+		r.promRegistry = prometheus.NewRegistry()
+		exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(r.promRegistry))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+		}
+		r.readers = append(r.readers, exporter)
+	}
+
+	return r, nil
+}
+
+func newOTLPExporter(ctx context.Context, cfg Config, collectorEndpoint string, temporality sdkmetric.TemporalitySelector) (sdkmetric.Exporter, error) {
+	if err := validateHostPort(collectorEndpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", collectorEndpoint, err)
+	}
+
+	tlsConfig, err := otlpTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var exporter sdkmetric.Exporter
+	if cfg.ExporterType == ExporterOTLPHTTP {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(collectorEndpoint),
+			otlpmetrichttp.WithTimeout(cfg.OTLPTimeout),
+			otlpmetrichttp.WithHeaders(cfg.OTLPHeaders),
+			otlpmetrichttp.WithTemporalitySelector(temporality),
+			otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{
+				Enabled:         !cfg.OTLPRetry.Disabled,
+				InitialInterval: cfg.OTLPRetry.InitialInterval,
+				MaxInterval:     cfg.OTLPRetry.MaxInterval,
+				MaxElapsedTime:  cfg.OTLPRetry.MaxElapsedTime,
+			}),
+		}
+		if tlsConfig == nil {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, opts...)
+	} else {
+		// The gRPC connection is established lazily and re-dialed in the
+		// background, so a collector that starts after the agent is picked
+		// up on a later export without a restart.
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(collectorEndpoint),
+			otlpmetricgrpc.WithTimeout(cfg.OTLPTimeout),
+			otlpmetricgrpc.WithHeaders(cfg.OTLPHeaders),
+			otlpmetricgrpc.WithTemporalitySelector(temporality),
+			otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig{
+				Enabled:         !cfg.OTLPRetry.Disabled,
+				InitialInterval: cfg.OTLPRetry.InitialInterval,
+				MaxInterval:     cfg.OTLPRetry.MaxInterval,
+				MaxElapsedTime:  cfg.OTLPRetry.MaxElapsedTime,
+			}),
+		}
+		if tlsConfig == nil {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if opt := cfg.OTLPKeepalive.dialOption(); opt != nil {
+			opts = append(opts, otlpmetricgrpc.WithDialOption(opt))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// otlpTLSConfig returns the TLS settings for OTLP connections, or nil
+// unless Config.OTLPSecure is set.
+func otlpTLSConfig(cfg Config) (*tls.Config, error) {
+	if !cfg.OTLPSecure {
+		return nil, nil
+	}
+	tlsConfig, err := cfg.OTLPTLS.build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure OTLP TLS: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// validateHostPort checks that endpoint is a host:port pair, which is what
+// the OTLP exporters expect rather than a URL.
+func validateHostPort(endpoint string) error {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("must be host:port: %w", err)
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// servePrometheus starts serving the registry on addr under /metrics. The
+// listener is bound before returning so address errors surface immediately,
+// and the server's Addr is the bound address, which resolves port 0.
+func servePrometheus(addr string, registry *prometheus.Registry, logger *slog.Logger) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: mux}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Prometheus endpoint stopped", "error", err)
+		}
+	}()
+
+	return srv, nil
+}
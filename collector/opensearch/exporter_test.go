@@ -0,0 +1,265 @@
+package opensearch
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+func TestPrometheusEndpointServesShardMetrics(t *testing.T) {
+	shards := map[string][]ShardInfo{
+		"logs": {{Index: "logs", Shard: "0", Prirep: "p", State: "STARTED", Docs: "10", DocsDeleted: "0", Store: "1kb", IP: "10.0.0.1", Node: "node-1"}},
+	}
+	srv := newTestServer(t, catShardsHandler(shards))
+	c, err := NewShardCollector(context.Background(),
+		WithConfig(Config{ExporterType: ExporterPrometheus, PrometheusListenAddr: "127.0.0.1:0"}),
+		WithOpenSearchEndpoint(srv.URL),
+		WithIndices("logs"),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("CollectMetrics: %v", err)
+	}
+
+	resp, err := http.Get("http://" + c.promServer.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape status %d: %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{
+		"opensearch_shard_store_size",
+		"opensearch_shard_docs_count",
+		"opensearch_shard_state",
+		`index="logs"`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("scrape is missing %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestTemporalitySelector(t *testing.T) {
+	kinds := []sdkmetric.InstrumentKind{
+		sdkmetric.InstrumentKindCounter,
+		sdkmetric.InstrumentKindHistogram,
+		sdkmetric.InstrumentKindObservableCounter,
+		sdkmetric.InstrumentKindObservableGauge,
+		sdkmetric.InstrumentKindUpDownCounter,
+		sdkmetric.InstrumentKindObservableUpDownCounter,
+	}
+	tests := []struct {
+		temporality Temporality
+		want        func(sdkmetric.InstrumentKind) metricdata.Temporality
+	}{
+		{
+			temporality: TemporalityCumulative,
+			want:        func(sdkmetric.InstrumentKind) metricdata.Temporality { return metricdata.CumulativeTemporality },
+		},
+		{
+			temporality: TemporalityDelta,
+			want: func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+				if kind == sdkmetric.InstrumentKindUpDownCounter || kind == sdkmetric.InstrumentKindObservableUpDownCounter {
+					return metricdata.CumulativeTemporality
+				}
+				return metricdata.DeltaTemporality
+			},
+		},
+	}
+	for _, tt := range tests {
+		selector, err := temporalitySelector(tt.temporality)
+		if err != nil {
+			t.Fatalf("temporalitySelector(%q): %v", tt.temporality, err)
+		}
+		for _, kind := range kinds {
+			if got, want := selector(kind), tt.want(kind); got != want {
+				t.Errorf("%s: %v is %v, want %v", tt.temporality, kind, got, want)
+			}
+		}
+	}
+
+	if _, err := temporalitySelector("monthly"); err == nil {
+		t.Error("temporalitySelector accepted an unknown temporality")
+	}
+	if cfg := (Config{}).withDefaults(); cfg.Temporality != TemporalityCumulative {
+		t.Errorf("default temporality = %q, want cumulative", cfg.Temporality)
+	}
+	if err := (Config{Temporality: "monthly"}).withDefaults().validate(); err == nil || !strings.Contains(err.Error(), `unknown temporality "monthly"`) {
+		t.Errorf("validate error = %v, want an unknown temporality", err)
+	}
+}
+
+func TestScrapeErrorsTemporality(t *testing.T) {
+	tests := []struct {
+		temporality Temporality
+		want        metricdata.Temporality
+		wantValues  []int64
+	}{
+		{temporality: TemporalityCumulative, want: metricdata.CumulativeTemporality, wantValues: []int64{1, 2, 3}},
+		{temporality: TemporalityDelta, want: metricdata.DeltaTemporality, wantValues: []int64{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.temporality), func(t *testing.T) {
+			selector, err := temporalitySelector(tt.temporality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(selector))
+			srv := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			c, err := NewShardCollector(context.Background(),
+				WithOpenSearchEndpoint(srv.URL),
+				WithReader(reader),
+				WithIndices("logs"),
+				WithConfig(Config{Logger: discardLogger}),
+			)
+			if err != nil {
+				t.Fatalf("NewShardCollector: %v", err)
+			}
+			defer c.Shutdown(context.Background())
+
+			for i, want := range tt.wantValues {
+				if err := c.CollectMetrics(context.Background()); err == nil {
+					t.Fatal("CollectMetrics succeeded against a failing cluster")
+				}
+				var rm metricdata.ResourceMetrics
+				if err := reader.Collect(context.Background(), &rm); err != nil {
+					t.Fatal(err)
+				}
+				sum, ok := findMetric(rm, "opensearch.collector.scrape.errors").Data.(metricdata.Sum[int64])
+				if !ok || len(sum.DataPoints) != 1 {
+					t.Fatalf("scrape %d: scrape errors = %+v, want one sum point", i+1, sum)
+				}
+				if sum.Temporality != tt.want {
+					t.Errorf("scrape %d: temporality = %v, want %v", i+1, sum.Temporality, tt.want)
+				}
+				if got := sum.DataPoints[0].Value; got != want {
+					t.Errorf("scrape %d: scrape errors = %d, want %d", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+// findMetric returns the metric called name in rm, or the zero Metrics.
+func findMetric(rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	return metricdata.Metrics{}
+}
+
+// metricsService is an in-process OTLP collector that sends the metric
+// names of every export it receives to exports.
+type metricsService struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	exports chan []string
+}
+
+func (s *metricsService) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	var names []string
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				names = append(names, m.Name)
+			}
+		}
+	}
+	select {
+	case s.exports <- names:
+	default:
+	}
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPExportsOnceCollectorStarts(t *testing.T) {
+	// Reserve an address for the collector, which isn't listening yet.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	shards := map[string][]ShardInfo{
+		"logs": {{Index: "logs", Shard: "0", Prirep: "p", State: "STARTED", Docs: "10", DocsDeleted: "0", Store: "1kb", IP: "10.0.0.1", Node: "node-1"}},
+	}
+	srv := newTestServer(t, catShardsHandler(shards))
+	c, err := NewShardCollector(context.Background(),
+		WithConfig(Config{
+			ExportInterval: time.Hour,
+			OTLPTimeout:    time.Second,
+			OTLPRetry:      OTLPRetryConfig{Disabled: true},
+			OTLPKeepalive:  OTLPKeepaliveConfig{Time: 10 * time.Second, Timeout: time.Second},
+			Logger:         discardLogger,
+		}),
+		WithOpenSearchEndpoint(srv.URL),
+		WithOTLPEndpoint(addr),
+		WithIndices("logs"),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("CollectMetrics: %v", err)
+	}
+	if err := c.ForceFlush(context.Background()); err == nil {
+		t.Fatal("ForceFlush succeeded without a collector")
+	}
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", addr, err)
+	}
+	svc := &metricsService{exports: make(chan []string, 1)}
+	gs := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(gs, svc)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+
+	// The exporter re-dials in the background, so a later flush reaches
+	// the collector without recreating anything.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err := c.ForceFlush(context.Background())
+		select {
+		case names := <-svc.exports:
+			if !slices.Contains(names, "opensearch.shard.state") {
+				t.Errorf("exported %v, want the shard metrics", names)
+			}
+			return
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no export reached the collector, last flush: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,37 @@
+package opensearch
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// indexFilter holds the compiled IncludeRegex and ExcludeRegex patterns.
+// A nil pattern matches everything for include and nothing for exclude.
+type indexFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newIndexFilter(cfg Config) (indexFilter, error) {
+	var f indexFilter
+	var err error
+	if cfg.IncludeRegex != "" {
+		if f.include, err = regexp.Compile(cfg.IncludeRegex); err != nil {
+			return indexFilter{}, fmt.Errorf("invalid include regex: %w", err)
+		}
+	}
+	if cfg.ExcludeRegex != "" {
+		if f.exclude, err = regexp.Compile(cfg.ExcludeRegex); err != nil {
+			return indexFilter{}, fmt.Errorf("invalid exclude regex: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// match reports whether index is collected. Exclusion wins over inclusion.
+func (f indexFilter) match(index string) bool {
+	if f.exclude != nil && f.exclude.MatchString(index) {
+		return false
+	}
+	return f.include == nil || f.include.MatchString(index)
+}
@@ -0,0 +1,199 @@
+package opensearch_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"instrumentation/collector/opensearch"
+	"instrumentation/collector/opensearch/opensearchtest"
+)
+
+// recordingExporter sends the metric names of every export to exports.
+type recordingExporter struct {
+	exports chan []string
+}
+
+func newRecordingExporter() *recordingExporter {
+	return &recordingExporter{exports: make(chan []string, 16)}
+}
+
+func (e *recordingExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *recordingExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *recordingExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	var names []string
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	e.exports <- names
+	return nil
+}
+
+func (e *recordingExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *recordingExporter) Shutdown(context.Context) error { return nil }
+
+func TestForceFlushExportsImmediately(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", Node: "node-1"})
+
+	// The periodic export is an hour away, so only ForceFlush can export.
+	exporter := newRecordingExporter()
+	c, err := opensearch.NewShardCollector(context.Background(),
+		opensearch.WithOpenSearchEndpoint(srv.URL),
+		opensearch.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(time.Hour))),
+		opensearch.WithIndices("logs"),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	defer c.Shutdown(context.Background())
+
+	if err := c.CollectMetrics(context.Background()); err != nil {
+		t.Fatalf("CollectMetrics: %v", err)
+	}
+	select {
+	case names := <-exporter.exports:
+		t.Fatalf("exported %v before ForceFlush", names)
+	default:
+	}
+
+	if err := c.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	select {
+	case names := <-exporter.exports:
+		if !slices.Contains(names, "opensearch.shard.state") {
+			t.Errorf("flushed %v, want the shard metrics", names)
+		}
+	default:
+		t.Fatal("ForceFlush did not export")
+	}
+}
+
+func TestRunnerFlushesAfterCollect(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", Node: "node-1"})
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+
+	exporter := newRecordingExporter()
+	c, err := opensearch.NewShardCollector(context.Background(),
+		opensearch.WithConfig(opensearch.Config{FlushAfterCollect: true}),
+		opensearch.WithOpenSearchEndpoint(srv.URL),
+		opensearch.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(time.Hour))),
+		opensearch.WithIndices("logs"),
+		opensearch.WithScrapeInterval(time.Minute),
+		opensearch.WithClock(clock),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	runner, err := opensearch.NewRunner(c)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		_ = runner.Shutdown(context.Background())
+	}()
+
+	// Run creates its ticker asynchronously, so keep ticking until the
+	// collection it triggers has been flushed.
+	deadline := time.After(5 * time.Second)
+	for {
+		clock.Advance(time.Minute)
+		select {
+		case names := <-exporter.exports:
+			if !slices.Contains(names, "opensearch.shard.state") {
+				t.Errorf("flushed %v, want the shard metrics", names)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no export after a scrape tick")
+		}
+	}
+}
+
+func TestRunnerJitterWaitsOnClock(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", Node: "node-1"})
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+
+	c, err := opensearch.NewShardCollector(context.Background(),
+		opensearch.WithConfig(opensearch.Config{ScrapeJitter: 20 * time.Second}),
+		opensearch.WithOpenSearchEndpoint(srv.URL),
+		opensearch.WithReader(sdkmetric.NewManualReader()),
+		opensearch.WithIndices("logs"),
+		opensearch.WithScrapeInterval(time.Minute),
+		opensearch.WithClock(clock),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	runner, err := opensearch.NewRunner(c)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		_ = runner.Shutdown(context.Background())
+	}()
+
+	// Tick until Run waits out its jitter on the fake clock.
+	deadline := time.After(5 * time.Second)
+	for clock.Waiters() == 0 {
+		clock.Advance(time.Minute)
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Run did not wait on the clock after a tick")
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := lastRequest(srv, "/_cat/shards"); got != "" {
+		t.Fatalf("scraped %s before the jitter elapsed", got)
+	}
+
+	// The jitter is shorter than 20s, so advancing that far releases the
+	// scrape without any real waiting.
+	clock.Advance(20 * time.Second)
+	for lastRequest(srv, "/_cat/shards") == "" {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no scrape after the jitter elapsed")
+		}
+	}
+}
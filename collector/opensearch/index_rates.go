@@ -0,0 +1,195 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// indexRatesQuery trims _stats to the indexing and query totals and skips
+// configured indices that don't exist.
+const indexRatesQuery = "ignore_unavailable=true&filter_path=indices.*.total.indexing.index_total,indices.*.total.search.query_total"
+
+// IndexRateCollector reports per-index indexing and search throughput,
+// derived from the _stats totals of two consecutive scrapes. It covers the
+// same indices as ShardCollector, including those behind Config.Aliases.
+// Like ClusterHealthCollector it records into a MeterProvider owned by the
+// caller.
+type IndexRateCollector struct {
+	client       *client
+	cfg          Config
+	indexFilter  indexFilter
+	aliases      *aliasResolver
+	meter        metric.Meter
+	registration metric.Registration
+
+	mu       sync.RWMutex
+	previous map[string]indexTotals
+	at       time.Time
+	rates    map[string]indexRates
+}
+
+// indexTotals are the cumulative counters _stats reports for one index.
+type indexTotals struct {
+	indexed int64
+	queries int64
+}
+
+// indexRates are per-second rates over the last scrape interval.
+type indexRates struct {
+	indexing float64
+	search   float64
+}
+
+func NewIndexRateCollector(endpoint string, meterProvider metric.MeterProvider, cfg Config, opts ...CompanionOption) (*IndexRateCollector, error) {
+	o := newCompanionOptions(DefaultIndexRatesMeterName, opts)
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	filter, err := newIndexFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &IndexRateCollector{
+		client:      client,
+		cfg:         cfg,
+		indexFilter: filter,
+		aliases:     newAliasResolver(cfg),
+		meter:       meterProvider.Meter(o.meterName),
+	}
+	if err := c.registerInstruments(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *IndexRateCollector) registerInstruments() error {
+	indexingRate, err := c.meter.Float64ObservableGauge(
+		"opensearch.index.indexing.rate",
+		metric.WithDescription("Documents indexed per second over the last scrape interval, primaries and replicas"),
+		metric.WithUnit("{documents}/s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create indexing rate gauge: %w", err)
+	}
+
+	searchRate, err := c.meter.Float64ObservableGauge(
+		"opensearch.index.search.rate",
+		metric.WithDescription("Search queries per second over the last scrape interval, across all shard copies"),
+		metric.WithUnit("{queries}/s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create search rate gauge: %w", err)
+	}
+
+	c.registration, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		rates := c.rates
+		c.mu.RUnlock()
+
+		for index, rate := range rates {
+			attrs := metric.WithAttributes(attribute.String("index", index))
+
+			o.ObserveFloat64(indexingRate, rate.indexing, attrs)
+			o.ObserveFloat64(searchRate, rate.search, attrs)
+		}
+		return nil
+	}, indexingRate, searchRate)
+	if err != nil {
+		return fmt.Errorf("failed to register callback: %w", err)
+	}
+
+	return nil
+}
+
+// CollectMetrics fetches the current totals and turns them into rates
+// against the previous scrape. Indices seen for the first time, and indices
+// whose totals went backwards because they were deleted and recreated,
+// report no rate until the next scrape. Aliases that resolve to no indices
+// report nothing.
+func (c *IndexRateCollector) CollectMetrics(ctx context.Context) error {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	targets, ok, err := c.aliases.targets(ctx, c.client, c.cfg.Indices)
+	if err != nil {
+		return fmt.Errorf("failed to fetch index stats: %w", err)
+	}
+	if !ok {
+		c.mu.Lock()
+		c.previous, c.at, c.rates = nil, time.Time{}, nil
+		c.mu.Unlock()
+		return nil
+	}
+	statsPath := "_stats/indexing,search"
+	if len(targets) > 0 {
+		statsPath = strings.Join(targets, ",") + "/" + statsPath
+	}
+	query := indexRatesQuery
+	if c.cfg.IncludeHidden {
+		query += "&expand_wildcards=all"
+	}
+
+	var resp struct {
+		Indices map[string]struct {
+			Total struct {
+				Indexing struct {
+					IndexTotal int64 `json:"index_total"`
+				} `json:"indexing"`
+				Search struct {
+					QueryTotal int64 `json:"query_total"`
+				} `json:"search"`
+			} `json:"total"`
+		} `json:"indices"`
+	}
+	if err := c.client.getJSON(ctx, statsPath, query, &resp); err != nil {
+		return fmt.Errorf("failed to fetch index stats: %w", err)
+	}
+	now := c.cfg.Clock.Now()
+
+	totals := make(map[string]indexTotals, len(resp.Indices))
+	for index, stats := range resp.Indices {
+		if c.indexFilter.match(index) {
+			totals[index] = indexTotals{indexed: stats.Total.Indexing.IndexTotal, queries: stats.Total.Search.QueryTotal}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rates := make(map[string]indexRates, len(totals))
+	if elapsed := now.Sub(c.at).Seconds(); !c.at.IsZero() && elapsed > 0 {
+		for index, current := range totals {
+			previous, ok := c.previous[index]
+			if !ok || current.indexed < previous.indexed || current.queries < previous.queries {
+				continue
+			}
+			rates[index] = indexRates{
+				indexing: float64(current.indexed-previous.indexed) / elapsed,
+				search:   float64(current.queries-previous.queries) / elapsed,
+			}
+		}
+	}
+	c.previous, c.at, c.rates = totals, now, rates
+
+	return nil
+}
+
+// Shutdown stops observing index rates. The MeterProvider is owned by the
+// caller and is not shut down.
+func (c *IndexRateCollector) Shutdown(_ context.Context) error {
+	return c.registration.Unregister()
+}
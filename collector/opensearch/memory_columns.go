@@ -0,0 +1,88 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// memoryColumn is an optional _cat/shards column reporting a memory size in
+// the same format as the store column.
+type memoryColumn struct {
+	column      string
+	name        string
+	description string
+	value       func(ShardInfo) string
+}
+
+// memoryColumns are requested when Config.MemoryColumns is set. The order
+// matches shardSample.memory.
+var memoryColumns = []memoryColumn{
+	{
+		column:      "completion.size",
+		name:        "opensearch.shard.completion.size",
+		description: "Memory used by the completion suggesters of the shard",
+		value:       func(s ShardInfo) string { return s.CompletionSize },
+	},
+	{
+		column:      "fielddata.memory_size",
+		name:        "opensearch.shard.fielddata.memory_size",
+		description: "Memory used by the fielddata cache of the shard",
+		value:       func(s ShardInfo) string { return s.FielddataMemory },
+	},
+	{
+		column:      "segments.memory",
+		name:        "opensearch.shard.segments.memory",
+		description: "Memory used by the segments of the shard",
+		value:       func(s ShardInfo) string { return s.SegmentsMemory },
+	},
+}
+
+// sizeValue is a parsed size that may be missing.
+type sizeValue struct {
+	bytes float64
+	ok    bool
+}
+
+// parseMemory parses the memory columns of shard, leaving empty values
+// missing.
+func (c *ShardCollector) parseMemory(ctx context.Context, shard ShardInfo) []sizeValue {
+	if !c.cfg.MemoryColumns {
+		return nil
+	}
+	values := make([]sizeValue, len(memoryColumns))
+	for i, col := range memoryColumns {
+		raw := col.value(shard)
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		bytes, err := convertStoreToBytes(raw)
+		if err != nil {
+			c.recordParseError(ctx, shard, col.column, err)
+			continue
+		}
+		values[i] = sizeValue{bytes: bytes, ok: true}
+	}
+	return values
+}
+
+func (c *ShardCollector) newMemoryGauges() ([]metric.Float64ObservableGauge, error) {
+	if !c.cfg.MemoryColumns {
+		return nil, nil
+	}
+	gauges := make([]metric.Float64ObservableGauge, len(memoryColumns))
+	for i, col := range memoryColumns {
+		gauge, err := c.meter.Float64ObservableGauge(
+			col.name,
+			metric.WithDescription(col.description),
+			metric.WithUnit("bytes"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s gauge: %w", col.column, err)
+		}
+		gauges[i] = gauge
+	}
+	return gauges, nil
+}
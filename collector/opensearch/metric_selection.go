@@ -0,0 +1,72 @@
+package opensearch
+
+import (
+	"fmt"
+	"path"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// storeSizeDistribution is an exponential histogram, so its buckets follow
+// shard sizes wherever they fall without configuring boundaries. The
+// Prometheus exporter doesn't support exponential histograms and drops it.
+const storeSizeDistribution = "opensearch.shard.store.size.distribution"
+
+// defaultView is the collector's own stream configuration. Metrics turned
+// off by Config.EnabledMetrics or Config.DisabledMetrics get the drop
+// aggregation, which makes their instruments no-ops and skips callbacks
+// whose instruments are all dropped. Views from WithView are wrapped with
+// selectedView, since a second matching view would add a stream of its own
+// and export the metric after all.
+func defaultView(cfg Config) sdkmetric.View {
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		stream := sdkmetric.Stream{Name: inst.Name, Description: inst.Description, Unit: inst.Unit}
+		switch {
+		case !cfg.metricEnabled(inst.Name):
+			stream.Aggregation = sdkmetric.AggregationDrop{}
+		case inst.Name == storeSizeDistribution:
+			stream.Aggregation = sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+		default:
+			return sdkmetric.Stream{}, false
+		}
+		return stream, true
+	}
+}
+
+// selectedView applies view only to enabled metrics, so a view passed to
+// WithView can't bring back a metric that defaultView drops.
+func selectedView(cfg Config, view sdkmetric.View) sdkmetric.View {
+	return func(inst sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		if !cfg.metricEnabled(inst.Name) {
+			return sdkmetric.Stream{}, false
+		}
+		return view(inst)
+	}
+}
+
+// metricEnabled reports whether the metric called name is exported.
+func (c Config) metricEnabled(name string) bool {
+	if len(c.EnabledMetrics) > 0 && !matchesMetric(c.EnabledMetrics, name) {
+		return false
+	}
+	return !matchesMetric(c.DisabledMetrics, name)
+}
+
+func matchesMetric(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMetricPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("metric name must not be empty")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid metric pattern %q: %w", pattern, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// localNodeQuery trims the _nodes/_local response to the node name.
+const localNodeQuery = "filter_path=nodes.*.name"
+
+// nodeFilter keeps the shards allocated to Config.Nodes and, with
+// Config.LocalNode, to the node serving the OpenSearch endpoint. The local
+// node is looked up on the first scrape and remembered.
+type nodeFilter struct {
+	nodes []string
+	local bool
+
+	mu        sync.Mutex
+	localNode string
+}
+
+func newNodeFilter(cfg Config) *nodeFilter {
+	return &nodeFilter{nodes: cfg.Nodes, local: cfg.LocalNode}
+}
+
+// resolve looks up the local node if it is needed and not yet known.
+func (f *nodeFilter) resolve(ctx context.Context, client *client) error {
+	if !f.local {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.localNode != "" {
+		return nil
+	}
+
+	var resp struct {
+		Nodes map[string]struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	}
+	if err := client.getJSON(ctx, "_nodes/_local", localNodeQuery, &resp); err != nil {
+		return fmt.Errorf("failed to look up the local node: %w", err)
+	}
+	for _, node := range resp.Nodes {
+		f.localNode = node.Name
+	}
+	if f.localNode == "" {
+		return fmt.Errorf("failed to look up the local node: no node in the response")
+	}
+	return nil
+}
+
+// match reports whether shard is kept. Without a node filter every shard
+// is; with one, unassigned shards are dropped as they belong to no node.
+func (f *nodeFilter) match(shard ShardInfo) bool {
+	if len(f.nodes) == 0 && !f.local {
+		return true
+	}
+	name := shard.Node
+	if source, _, ok := shard.RelocationNodes(); ok {
+		name = source
+	}
+	if name == "" {
+		return false
+	}
+	for _, node := range f.nodes {
+		if node == name || node == shard.NodeIP() {
+			return true
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.local && f.localNode == name
+}
@@ -0,0 +1,162 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// nodeStatsQuery restricts _nodes/stats to the metric groups and fields we
+// export, which keeps the response small on large clusters.
+const nodeStatsQuery = "filter_path=nodes.*.name,nodes.*.jvm.mem.heap_used_percent," +
+	"nodes.*.fs.total.total_in_bytes,nodes.*.fs.total.available_in_bytes,nodes.*.os.cpu.percent"
+
+// NodeStatsCollector reports per-node resource usage from _nodes/stats. Like
+// ClusterHealthCollector it records into a MeterProvider owned by the caller.
+type NodeStatsCollector struct {
+	client       *client
+	meter        metric.Meter
+	registration metric.Registration
+
+	mu    sync.RWMutex
+	nodes []NodeStats
+}
+
+type NodeStats struct {
+	Name string `json:"name"`
+	JVM  struct {
+		Mem struct {
+			HeapUsedPercent int64 `json:"heap_used_percent"`
+		} `json:"mem"`
+	} `json:"jvm"`
+	FS struct {
+		Total struct {
+			TotalInBytes     int64 `json:"total_in_bytes"`
+			AvailableInBytes int64 `json:"available_in_bytes"`
+		} `json:"total"`
+	} `json:"fs"`
+	OS struct {
+		CPU struct {
+			Percent int64 `json:"percent"`
+		} `json:"cpu"`
+	} `json:"os"`
+}
+
+func NewNodeStatsCollector(endpoint string, meterProvider metric.MeterProvider, cfg Config, opts ...CompanionOption) (*NodeStatsCollector, error) {
+	o := newCompanionOptions(DefaultNodeStatsMeterName, opts)
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	client, err := newClient(endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &NodeStatsCollector{
+		client: client,
+		meter:  meterProvider.Meter(o.meterName),
+	}
+	if err := c.registerInstruments(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *NodeStatsCollector) registerInstruments() error {
+	heapUsed, err := c.meter.Int64ObservableGauge(
+		"opensearch.node.jvm.heap.used_percent",
+		metric.WithDescription("JVM heap used as a percentage of the maximum heap"),
+		metric.WithUnit("%"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create heap used gauge: %w", err)
+	}
+
+	fsAvailable, err := c.meter.Int64ObservableGauge(
+		"opensearch.node.fs.available",
+		metric.WithDescription("Filesystem bytes available to the node"),
+		metric.WithUnit("bytes"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create filesystem available gauge: %w", err)
+	}
+
+	fsTotal, err := c.meter.Int64ObservableGauge(
+		"opensearch.node.fs.total",
+		metric.WithDescription("Total filesystem bytes of the node"),
+		metric.WithUnit("bytes"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create filesystem total gauge: %w", err)
+	}
+
+	cpuPercent, err := c.meter.Int64ObservableGauge(
+		"opensearch.node.cpu.percent",
+		metric.WithDescription("Recent CPU usage of the node"),
+		metric.WithUnit("%"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create cpu gauge: %w", err)
+	}
+
+	c.registration, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		nodes := c.nodes
+		c.mu.RUnlock()
+
+		for _, node := range nodes {
+			attrs := metric.WithAttributes(attribute.String("node", node.Name))
+
+			o.ObserveInt64(heapUsed, node.JVM.Mem.HeapUsedPercent, attrs)
+			o.ObserveInt64(fsAvailable, node.FS.Total.AvailableInBytes, attrs)
+			o.ObserveInt64(fsTotal, node.FS.Total.TotalInBytes, attrs)
+			o.ObserveInt64(cpuPercent, node.OS.CPU.Percent, attrs)
+		}
+		return nil
+	}, heapUsed, fsAvailable, fsTotal, cpuPercent)
+	if err != nil {
+		return fmt.Errorf("failed to register callback: %w", err)
+	}
+
+	return nil
+}
+
+// CollectMetrics fetches the current node stats and stores them for the next
+// export. The previous snapshot is replaced, so nodes that left the cluster
+// stop being reported instead of repeating their last values.
+func (c *NodeStatsCollector) CollectMetrics(ctx context.Context) error {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	var resp struct {
+		Nodes map[string]NodeStats `json:"nodes"`
+	}
+	if err := c.client.getJSON(ctx, "_nodes/stats/jvm,fs,os", nodeStatsQuery, &resp); err != nil {
+		return fmt.Errorf("failed to fetch node stats: %w", err)
+	}
+
+	nodes := make([]NodeStats, 0, len(resp.Nodes))
+	for _, node := range resp.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	c.mu.Lock()
+	c.nodes = nodes
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Shutdown stops observing node stats. The MeterProvider is owned by the
+// caller and is not shut down.
+func (c *NodeStatsCollector) Shutdown(_ context.Context) error {
+	return c.registration.Unregister()
+}
@@ -0,0 +1,272 @@
+// Package opensearchtest provides an in-process OpenSearch stub serving
+// canned _cat/shards, _stats/docs, _cluster/health, _nodes/_local and _alias
+// responses, and a fake Clock, for exercising the collectors without a real
+// cluster.
+package opensearchtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"instrumentation/collector/opensearch"
+)
+
+// Server is an httptest.Server that mimics the OpenSearch endpoints used by
+// the collectors. Pass its URL to opensearch.WithOpenSearchEndpoint.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	shards    map[string][]opensearch.ShardInfo
+	health    opensearch.ClusterHealth
+	responses map[string]response
+	requests  []string
+	gzip      bool
+	localNode string
+	aliases   map[string][]string
+}
+
+// response is a canned reply that replaces the normal handling of a path.
+type response struct {
+	status      int
+	contentType string
+	body        string
+}
+
+// NewServer starts a stub with no indices and a green cluster. Callers
+// should Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		shards:    make(map[string][]opensearch.ShardInfo),
+		health:    opensearch.ClusterHealth{ClusterName: "opensearchtest", Status: "green", NumberOfNodes: 1},
+		localNode: "node-1",
+		aliases:   make(map[string][]string),
+		responses: make(map[string]response),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetShards replaces the shards reported for index. The Index field of each
+// shard is set to index.
+func (s *Server) SetShards(index string, shards ...opensearch.ShardInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := make([]opensearch.ShardInfo, len(shards))
+	for i, shard := range shards {
+		shard.Index = index
+		copied[i] = shard
+	}
+	s.shards[index] = copied
+}
+
+// DeleteIndex removes index, so requests naming it get a 404.
+func (s *Server) DeleteIndex(index string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shards, index)
+}
+
+// SetClusterHealth replaces the _cluster/health response.
+func (s *Server) SetClusterHealth(health opensearch.ClusterHealth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = health
+}
+
+// SetLocalNode sets the node name reported by _nodes/_local, "node-1" by
+// default.
+func (s *Server) SetLocalNode(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.localNode = name
+}
+
+// SetAlias points alias at indices, replacing what it pointed to before. An
+// alias without indices is removed, so _alias returns a 404 for it.
+func (s *Server) SetAlias(alias string, indices ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(indices) == 0 {
+		delete(s.aliases, alias)
+		return
+	}
+	s.aliases[alias] = append([]string(nil), indices...)
+}
+
+// SetResponse makes requests for urlPath, such as "/_cat/shards/logs",
+// return status and body verbatim, e.g. to provoke status or decode errors.
+func (s *Server) SetResponse(urlPath string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[urlPath] = response{status: status, contentType: "application/json", body: body}
+}
+
+// SetTextResponse is like SetResponse but serves body as text/plain, as the
+// _cat APIs do when format=json is lost on the way.
+func (s *Server) SetTextResponse(urlPath string, status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[urlPath] = response{status: status, contentType: "text/plain; charset=UTF-8", body: body}
+}
+
+// SetGzip makes the server gzip its responses to clients that accept it, as
+// OpenSearch does with http.compression enabled.
+func (s *Server) SetGzip(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gzip = enabled
+}
+
+// Requests returns the request URIs received so far, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.URL.RequestURI())
+
+	if s.gzip && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w = gzipResponseWriter{ResponseWriter: w, w: gz}
+	}
+
+	if resp, ok := s.responses[r.URL.Path]; ok {
+		w.Header().Set("Content-Type", resp.contentType)
+		w.WriteHeader(resp.status)
+		fmt.Fprint(w, resp.body)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/_cluster/health":
+		writeJSON(w, http.StatusOK, s.health)
+	case r.URL.Path == "/_nodes/_local":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"nodes": map[string]any{"local": map[string]string{"name": s.localNode}},
+		})
+	case strings.HasPrefix(r.URL.Path, "/_alias/"):
+		alias := strings.TrimPrefix(r.URL.Path, "/_alias/")
+		indices, ok := s.aliases[alias]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{
+				"error":  fmt.Sprintf("alias [%s] missing", alias),
+				"status": http.StatusNotFound,
+			})
+			return
+		}
+		resp := make(map[string]any, len(indices))
+		for _, index := range indices {
+			resp[index] = map[string]any{"aliases": map[string]any{alias: map[string]any{}}}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case r.URL.Path == "/_stats/docs":
+		writeJSON(w, http.StatusOK, docsStats(s.match(nil)))
+	case strings.HasSuffix(r.URL.Path, "/_stats/docs"):
+		targets := strings.Split(strings.Trim(strings.TrimSuffix(r.URL.Path, "_stats/docs"), "/"), ",")
+		writeJSON(w, http.StatusOK, docsStats(s.match(targets)))
+	case r.URL.Path == "/_cat/shards":
+		writeJSON(w, http.StatusOK, s.match(nil))
+	case strings.HasPrefix(r.URL.Path, "/_cat/shards/"):
+		targets := strings.Split(strings.TrimPrefix(r.URL.Path, "/_cat/shards/"), ",")
+		for _, target := range targets {
+			if _, ok := s.shards[target]; !ok && !strings.Contains(target, "*") {
+				writeJSON(w, http.StatusNotFound, map[string]any{
+					"error":  map[string]string{"type": "index_not_found_exception", "index": target},
+					"status": http.StatusNotFound,
+				})
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, s.match(targets))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// match returns the shards of all indices named or matched by targets, or of
+// every index when targets is nil, in index order.
+func (s *Server) match(targets []string) []opensearch.ShardInfo {
+	indices := make([]string, 0, len(s.shards))
+	for index := range s.shards {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+
+	shards := []opensearch.ShardInfo{}
+	for _, index := range indices {
+		if targets != nil && !matchesAny(targets, index) {
+			continue
+		}
+		shards = append(shards, s.shards[index]...)
+	}
+	return shards
+}
+
+// docsStats sums the document counts of the primaries in shards into a
+// _stats/docs response. Values that don't parse count as 0.
+func docsStats(shards []opensearch.ShardInfo) map[string]any {
+	type docs struct {
+		Count   int64 `json:"count"`
+		Deleted int64 `json:"deleted"`
+	}
+	totals := make(map[string]*docs)
+	for _, shard := range shards {
+		if _, ok := totals[shard.Index]; !ok {
+			totals[shard.Index] = &docs{}
+		}
+		if shard.Prirep != "p" {
+			continue
+		}
+		count, _ := strconv.ParseInt(strings.TrimSpace(shard.Docs), 10, 64)
+		deleted, _ := strconv.ParseInt(strings.TrimSpace(shard.DocsDeleted), 10, 64)
+		totals[shard.Index].Count += count
+		totals[shard.Index].Deleted += deleted
+	}
+	indices := make(map[string]any, len(totals))
+	for index, total := range totals {
+		indices[index] = map[string]any{"primaries": map[string]any{"docs": total}}
+	}
+	return map[string]any{"indices": indices}
+}
+
+func matchesAny(targets []string, index string) bool {
+	for _, target := range targets {
+		if ok, _ := path.Match(target, index); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w gzipResponseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,214 @@
+package opensearch
+
+import (
+	"errors"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a ShardCollector created with NewShardCollector.
+type Option func(*options)
+
+type options struct {
+	endpoint          string
+	collectorEndpoint string
+	cfg               Config
+	readers           []sdkmetric.Reader
+	views             []sdkmetric.View
+	tracerProvider    trace.TracerProvider
+	meterName         string
+}
+
+// DefaultMeterName is the instrumentation scope of the shard metrics.
+const DefaultMeterName = "opensearch.shards"
+
+// WithConfig sets every Config field at once. Options applied after it
+// override individual fields, so it usually comes first.
+func WithConfig(cfg Config) Option {
+	return func(o *options) {
+		o.cfg = cfg
+	}
+}
+
+// WithOpenSearchEndpoint sets the OpenSearch base URL. It is required.
+func WithOpenSearchEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithOTLPEndpoint sets the collector host:port metrics are pushed to. It is
+// required for the OTLP exporter types.
+func WithOTLPEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.collectorEndpoint = endpoint
+	}
+}
+
+// WithIndices sets the indices or index patterns to collect.
+func WithIndices(indices ...string) Option {
+	return func(o *options) {
+		o.cfg.Indices = indices
+	}
+}
+
+// WithBasicAuth enables HTTP basic authentication against OpenSearch.
+func WithBasicAuth(username, password string) Option {
+	return func(o *options) {
+		o.cfg.Username = username
+		o.cfg.Password = password
+	}
+}
+
+// WithAPIKey authenticates against OpenSearch with an API key.
+func WithAPIKey(key string) Option {
+	return func(o *options) {
+		o.cfg.APIKey = key
+	}
+}
+
+// WithBearerToken authenticates against OpenSearch with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(o *options) {
+		o.cfg.BearerToken = token
+	}
+}
+
+// WithTokenProvider authenticates against OpenSearch with bearer tokens
+// obtained from provider.
+func WithTokenProvider(provider TokenProvider) Option {
+	return func(o *options) {
+		o.cfg.TokenProvider = provider
+	}
+}
+
+// WithUserAgent sets the User-Agent header of OpenSearch requests.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.cfg.UserAgent = userAgent
+	}
+}
+
+// WithOTLPHeaders sets headers sent with every OTLP export, such as
+// authorization for a hosted collector.
+func WithOTLPHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		o.cfg.OTLPHeaders = headers
+	}
+}
+
+// WithClock replaces the system clock, e.g. with a fake one in tests.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		o.cfg.Clock = clock
+	}
+}
+
+// WithScrapeInterval sets how often CollectMetrics is expected to run.
+func WithScrapeInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.cfg.ScrapeInterval = interval
+	}
+}
+
+// WithReader records metrics into reader instead of the exporter selected by
+// Config.ExporterType, so no OTLP endpoint is needed. A sdkmetric.ManualReader
+// lets callers Collect and inspect the resulting metricdata. It may be given
+// more than once.
+func WithReader(reader sdkmetric.Reader) Option {
+	return func(o *options) {
+		o.readers = append(o.readers, reader)
+	}
+}
+
+// WithView applies views to the collector's MeterProvider, to rename
+// instruments, change histogram buckets or drop attributes. For example, to
+// drop the ip attribute from the store size gauge:
+//
+//	opensearch.WithView(sdkmetric.NewView(
+//		sdkmetric.Instrument{Name: "opensearch.shard.store.size"},
+//		sdkmetric.Stream{AttributeFilter: attribute.NewDenyKeysFilter("ip")},
+//	))
+//
+// Views don't apply to metrics turned off by Config.EnabledMetrics or
+// Config.DisabledMetrics.
+func WithView(views ...sdkmetric.View) Option {
+	return func(o *options) {
+		o.views = append(o.views, views...)
+	}
+}
+
+// WithTracerProvider records a span for every scrape and observation with
+// provider, instead of the OTLP provider enabled by Config.Tracing.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+	}
+}
+
+// WithMeterName sets the instrumentation scope the shard metrics are
+// recorded under, such as "opensearch.shards.prod-eu", to tell collectors for
+// different clusters in one process apart. It defaults to DefaultMeterName.
+func WithMeterName(name string) Option {
+	return func(o *options) {
+		o.meterName = name
+	}
+}
+
+// CompanionOption configures a collector that records into the
+// MeterProvider of another collector, such as one created with
+// NewClusterHealthCollector.
+type CompanionOption func(*companionOptions)
+
+type companionOptions struct {
+	meterName string
+}
+
+// Default instrumentation scopes of the companion collectors.
+const (
+	DefaultClusterHealthMeterName = "opensearch.cluster"
+	DefaultPendingTasksMeterName  = "opensearch.cluster"
+	DefaultNodeStatsMeterName     = "opensearch.nodes"
+	DefaultIndexRatesMeterName    = "opensearch.indices"
+)
+
+// WithCompanionMeterName sets the instrumentation scope a companion
+// collector records under, like WithMeterName does for a ShardCollector. It
+// defaults to the Default*MeterName constant of the collector.
+func WithCompanionMeterName(name string) CompanionOption {
+	return func(o *companionOptions) {
+		o.meterName = name
+	}
+}
+
+func newCompanionOptions(meterName string, opts []CompanionOption) companionOptions {
+	o := companionOptions{meterName: meterName}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func newOptions(opts []Option) (options, error) {
+	o := options{meterName: DefaultMeterName}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.cfg = o.cfg.withDefaults()
+
+	if o.endpoint == "" {
+		return options{}, errors.New("an OpenSearch endpoint is required")
+	}
+	if o.meterName == "" {
+		return options{}, errors.New("the meter name must not be empty")
+	}
+	switch o.cfg.ExporterType {
+	case ExporterOTLP, ExporterOTLPHTTP:
+		if o.collectorEndpoint == "" && len(o.readers) == 0 {
+			return options{}, errors.New("an OTLP endpoint is required")
+		}
+	}
+	return o, nil
+}
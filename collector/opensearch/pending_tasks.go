@@ -0,0 +1,127 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// pendingTasksQuery trims _cluster/pending_tasks to the time each task has
+// been queued. A cluster with no pending tasks answers with an empty object.
+const pendingTasksQuery = "filter_path=tasks.time_in_queue_millis"
+
+// PendingTasksCollector reports the cluster manager's task queue from
+// _cluster/pending_tasks; a growing queue indicates an overloaded cluster
+// manager. Like ClusterHealthCollector it records into a MeterProvider owned
+// by the caller.
+type PendingTasksCollector struct {
+	client       *client
+	meter        metric.Meter
+	registration metric.Registration
+
+	mu    sync.RWMutex
+	tasks *pendingTasks
+}
+
+// pendingTasks summarises one _cluster/pending_tasks response.
+type pendingTasks struct {
+	count  int64
+	oldest time.Duration
+}
+
+func NewPendingTasksCollector(endpoint string, meterProvider metric.MeterProvider, cfg Config, opts ...CompanionOption) (*PendingTasksCollector, error) {
+	o := newCompanionOptions(DefaultPendingTasksMeterName, opts)
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	client, err := newClient(endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &PendingTasksCollector{
+		client: client,
+		meter:  meterProvider.Meter(o.meterName),
+	}
+	if err := c.registerInstruments(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *PendingTasksCollector) registerInstruments() error {
+	count, err := c.meter.Int64ObservableGauge(
+		"opensearch.cluster.pending_tasks",
+		metric.WithDescription("Number of cluster-level changes waiting to be executed"),
+		metric.WithUnit("{tasks}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create pending tasks gauge: %w", err)
+	}
+
+	oldest, err := c.meter.Float64ObservableGauge(
+		"opensearch.cluster.pending_tasks.oldest.time_in_queue",
+		metric.WithDescription("Time the oldest pending cluster task has been waiting; 0 when the queue is empty"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oldest pending task gauge: %w", err)
+	}
+
+	c.registration, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		tasks := c.tasks
+		c.mu.RUnlock()
+
+		if tasks == nil {
+			return nil
+		}
+		o.ObserveInt64(count, tasks.count)
+		o.ObserveFloat64(oldest, tasks.oldest.Seconds())
+		return nil
+	}, count, oldest)
+	if err != nil {
+		return fmt.Errorf("failed to register callback: %w", err)
+	}
+
+	return nil
+}
+
+// CollectMetrics fetches the pending cluster tasks and stores their count
+// and the age of the oldest for the next export.
+func (c *PendingTasksCollector) CollectMetrics(ctx context.Context) error {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	var resp struct {
+		Tasks []struct {
+			TimeInQueueMillis int64 `json:"time_in_queue_millis"`
+		} `json:"tasks"`
+	}
+	if err := c.client.getJSON(ctx, "_cluster/pending_tasks", pendingTasksQuery, &resp); err != nil {
+		return fmt.Errorf("failed to fetch pending tasks: %w", err)
+	}
+
+	tasks := &pendingTasks{count: int64(len(resp.Tasks))}
+	for _, task := range resp.Tasks {
+		tasks.oldest = max(tasks.oldest, time.Duration(task.TimeInQueueMillis)*time.Millisecond)
+	}
+
+	c.mu.Lock()
+	c.tasks = tasks
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Shutdown stops observing pending tasks. The MeterProvider is owned by the
+// caller and is not shut down.
+func (c *PendingTasksCollector) Shutdown(_ context.Context) error {
+	return c.registration.Unregister()
+}
@@ -0,0 +1,136 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Runner drives a ShardCollector and any number of companion collectors on
+// one ticker. The ShardCollector owns the MeterProvider and exporter they
+// share, so companions should be created with Runner.MeterProvider.
+type Runner struct {
+	shards     *ShardCollector
+	collectors []Collector
+	breaker    *breaker
+}
+
+// NewRunner returns a Runner for shards and collectors. More collectors may
+// be added with Add before Run is called.
+func NewRunner(shards *ShardCollector, collectors ...Collector) (*Runner, error) {
+	r := &Runner{shards: shards, collectors: collectors, breaker: newBreaker(shards.cfg)}
+
+	_, err := shards.meter.Int64ObservableGauge(
+		"opensearch.collector.breaker.state",
+		metric.WithDescription("Circuit breaker state: 0 closed, 1 open and probing at a reduced rate"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			var state int64
+			if r.breaker.open() {
+				state = 1
+			}
+			o.Observe(state)
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create breaker state gauge: %w", err)
+	}
+	return r, nil
+}
+
+// Add registers another collector. It must not be called once Run started.
+func (r *Runner) Add(c Collector) {
+	r.collectors = append(r.collectors, c)
+}
+
+// MeterProvider returns the provider shared by all of the Runner's collectors.
+func (r *Runner) MeterProvider() metric.MeterProvider {
+	return r.shards.MeterProvider()
+}
+
+// Run collects on every tick of the shard collector's scrape interval, after
+// a random delay of up to its scrape jitter, until ctx is cancelled. Ticks
+// are skipped while the circuit breaker is open. Export failures after a
+// collection don't count towards the breaker.
+func (r *Runner) Run(ctx context.Context) {
+	ticker := r.shards.cfg.Clock.NewTicker(r.shards.ScrapeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if !r.breaker.allow() {
+				continue
+			}
+			if jitter := r.shards.ScrapeJitter(); jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-r.shards.cfg.Clock.After(rand.N(jitter)):
+				}
+			}
+			r.recordCycle(r.Collect(ctx))
+			if r.shards.cfg.FlushAfterCollect {
+				if err := r.Flush(ctx); err != nil {
+					r.shards.cfg.Logger.Error("Failed to flush metrics", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (r *Runner) recordCycle(err error) {
+	opened, closed := r.breaker.record(err)
+	switch {
+	case opened:
+		r.shards.cfg.Logger.Warn("Circuit breaker opened, scraping less often until OpenSearch recovers",
+			"failures", r.breaker.threshold, "max_interval", r.shards.cfg.BreakerMaxInterval)
+	case closed:
+		r.shards.cfg.Logger.Info("Circuit breaker closed, resuming the scrape interval")
+	}
+}
+
+// Collect runs one collection of every collector in turn. Failures are
+// logged; the returned error is that of the shard collector.
+func (r *Runner) Collect(ctx context.Context) error {
+	logger := r.shards.cfg.Logger
+
+	err := r.shards.CollectMetrics(ctx)
+	if err != nil {
+		logger.Error("Failed to collect metrics", "error", err)
+	}
+	for _, c := range r.collectors {
+		if err := c.CollectMetrics(ctx); err != nil {
+			logger.Error("Failed to collect metrics", "collector", fmt.Sprintf("%T", c), "error", err)
+		}
+	}
+	return err
+}
+
+// Flush exports what the collectors have recorded so far, see
+// ShardCollector.ForceFlush. Run calls it after every collection when
+// Config.FlushAfterCollect is set.
+func (r *Runner) Flush(ctx context.Context) error {
+	return r.shards.ForceFlush(ctx)
+}
+
+// Shutdown stops the companion collectors, in reverse order, and then the
+// shard collector, which flushes the shared exporter within its
+// Config.FlushTimeout.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	var errs []error
+	for i := len(r.collectors) - 1; i >= 0; i-- {
+		if err := r.collectors[i].Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := r.shards.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
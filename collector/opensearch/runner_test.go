@@ -0,0 +1,72 @@
+package opensearch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// blockingExporter never completes an export before its context ends, like
+// an exporter whose collector is unreachable.
+type blockingExporter struct{}
+
+func (blockingExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (blockingExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (blockingExporter) Export(ctx context.Context, _ *metricdata.ResourceMetrics) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (blockingExporter) ForceFlush(context.Context) error { return nil }
+
+func (blockingExporter) Shutdown(context.Context) error { return nil }
+
+func TestRunnerStopsWhenCancelled(t *testing.T) {
+	srv := newTestServer(t, catShardsHandler(nil))
+	c, err := NewShardCollector(context.Background(),
+		WithConfig(Config{FlushTimeout: 50 * time.Millisecond}),
+		WithOpenSearchEndpoint(srv.URL),
+		WithReader(sdkmetric.NewPeriodicReader(blockingExporter{})),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	runner, err := NewRunner(c)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+
+	// The final export can't complete, so shutdown gives up after the flush
+	// timeout rather than hanging.
+	start := time.Now()
+	err = runner.Shutdown(context.Background())
+	if !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("Shutdown error = %v, want ErrFlushTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Shutdown took %s", elapsed)
+	}
+}
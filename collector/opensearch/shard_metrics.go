@@ -2,27 +2,70 @@ package opensearch
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ShardCollector struct {
-	client        *http.Client
-	endpoint      string
+	client        *client
+	cfg           Config
 	meterProvider *sdkmetric.MeterProvider
 	meter         metric.Meter
+	promServer    *http.Server
+	indexFilter   indexFilter
+	nodeFilter    *nodeFilter
+	aliases       *aliasResolver
+
+	tracer         trace.Tracer
+	tracerProvider *sdktrace.TracerProvider
+
+	scrapeErrors   metric.Int64Counter
+	scrapeDuration metric.Float64Histogram
+	storeSizes     metric.Float64Histogram
+	otelErrors     metric.Int64Counter
+	missingIndices metric.Int64Counter
+
+	mu          sync.RWMutex
+	snapshot    snapshot
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// shardColumns are the _cat/shards columns always requested with h=. Each
+// must match a json tag on ShardInfo. OpenSearch leaves out requested
+// columns it doesn't have, which current releases do for docs.deleted.
+const shardColumns = "index,shard,prirep,state,docs,docs.deleted,store,ip,node,unassigned.reason"
+
+// columns returns the h= parameter for _cat/shards.
+func (c *ShardCollector) columns() string {
+	columns := []string{shardColumns}
+	if c.cfg.SegmentsCount {
+		columns = append(columns, "segments.count")
+	}
+	if c.cfg.MemoryColumns {
+		for _, col := range memoryColumns {
+			columns = append(columns, col.column)
+		}
+	}
+	return strings.Join(columns, ",")
 }
 
 type ShardInfo struct {
@@ -34,136 +77,805 @@ type ShardInfo struct {
 	Store  string `json:"store"`
 	IP     string `json:"ip"`
 	Node   string `json:"node"`
+	// DocsDeleted is empty when the cluster doesn't report the column, in
+	// which case the deleted document counts come from _stats instead.
+	DocsDeleted string `json:"docs.deleted,omitempty"`
+	// UnassignedReason explains why an UNASSIGNED shard is not allocated,
+	// e.g. NODE_LEFT. It is empty for assigned shards.
+	UnassignedReason string `json:"unassigned.reason"`
+
+	// CompletionSize, FielddataMemory and SegmentsMemory are only requested
+	// when Config.MemoryColumns is set.
+	CompletionSize  string `json:"completion.size,omitempty"`
+	FielddataMemory string `json:"fielddata.memory_size,omitempty"`
+	SegmentsMemory  string `json:"segments.memory,omitempty"`
+	// SegmentsCount is only requested when Config.SegmentsCount is set.
+	SegmentsCount string `json:"segments.count,omitempty"`
 }
 
-func NewShardCollector(ctx context.Context, endpoint string, collectorEndpoint string) (*ShardCollector, error) {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("opensearch-shard-collector"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+// NewShardCollector creates a collector from opts. WithOpenSearchEndpoint is
+// required, and so is WithOTLPEndpoint unless another exporter or a reader
+// is configured.
+func NewShardCollector(ctx context.Context, opts ...Option) (*ShardCollector, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	endpoint, collectorEndpoint, cfg := o.endpoint, o.collectorEndpoint, o.cfg
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	filter, err := newIndexFilter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	client, err := newClient(endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	exporter, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithEndpoint(collectorEndpoint),
-		otlpmetricgrpc.WithInsecure(),
-	)
+	readers := &readers{readers: o.readers}
+	if len(o.readers) == 0 {
+		readers, err = newReaders(ctx, cfg, collectorEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	providerOpts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	for _, reader := range readers.readers {
+		providerOpts = append(providerOpts, sdkmetric.WithReader(reader))
+	}
+	views := []sdkmetric.View{defaultView(cfg)}
+	for _, view := range o.views {
+		views = append(views, selectedView(cfg, view))
+	}
+	providerOpts = append(providerOpts, sdkmetric.WithView(views...))
+	meterProvider := sdkmetric.NewMeterProvider(providerOpts...)
+	otel.SetMeterProvider(meterProvider)
+
+	meter := meterProvider.Meter(o.meterName)
+
+	tracerProvider, ownedTracerProvider, err := newTracerProvider(ctx, cfg, collectorEndpoint, res, o.tracerProvider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create exporter: %w", err)
+		_ = meterProvider.Shutdown(ctx)
+		return nil, err
 	}
 
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(
-			sdkmetric.NewPeriodicReader(
-				exporter,
-				sdkmetric.WithInterval(10*time.Second),
-			),
-		),
+	c := &ShardCollector{
+		client:         client,
+		cfg:            cfg,
+		meterProvider:  meterProvider,
+		meter:          meter,
+		indexFilter:    filter,
+		nodeFilter:     newNodeFilter(cfg),
+		aliases:        newAliasResolver(cfg),
+		tracer:         tracerProvider.Tracer(tracerName),
+		tracerProvider: ownedTracerProvider,
+	}
+	if err := c.registerInstruments(); err != nil {
+		_ = c.Shutdown(ctx)
+		return nil, err
+	}
+	if readers.promRegistry != nil {
+		c.promServer, err = servePrometheus(cfg.PrometheusListenAddr, readers.promRegistry, cfg.Logger)
+		if err != nil {
+			_ = c.Shutdown(ctx)
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Handle logs and counts an OpenTelemetry error, which makes the collector
+// an otel.ErrorHandler. The gRPC exporters connect lazily, so a wrong or
+// unreachable collector endpoint only shows up there, when an export fails,
+// and not in NewShardCollector. The handler is process-wide, so it is left
+// to the application to install it with otel.SetErrorHandler.
+func (c *ShardCollector) Handle(err error) {
+	c.cfg.Logger.Error("OpenTelemetry error", "exporter", c.cfg.ExporterType, "error", err)
+	c.otelErrors.Add(context.Background(), 1)
+}
+
+var _ otel.ErrorHandler = (*ShardCollector)(nil)
+
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	keys := make([]string, 0, len(cfg.ResourceAttributes))
+	for key := range cfg.ResourceAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]attribute.KeyValue, 0, len(keys)+2)
+	for _, key := range keys {
+		attrs = append(attrs, attribute.String(key, cfg.ResourceAttributes[key]))
+	}
+	attrs = append(attrs,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.ServiceVersion),
 	)
-	otel.SetMeterProvider(meterProvider)
 
-	meter := meterProvider.Meter("opensearch.shards")
+	return resource.New(ctx, resource.WithAttributes(attrs...))
+}
+
+// ScrapeInterval returns the effective interval at which CollectMetrics
+// should be invoked.
+func (c *ShardCollector) ScrapeInterval() time.Duration {
+	return c.cfg.ScrapeInterval
+}
 
-	return &ShardCollector{
-		client:        &http.Client{Timeout: 10 * time.Second},
-		endpoint:      endpoint,
-		meterProvider: meterProvider,
-		meter:         meter,
-	}, nil
+// ScrapeJitter returns the maximum random delay to apply to each scrape
+// after its tick.
+func (c *ShardCollector) ScrapeJitter() time.Duration {
+	return c.cfg.ScrapeJitter
 }
 
-func (c *ShardCollector) CollectMetrics(ctx context.Context) error {
+// Clock returns the clock the collector records scrape times with, so
+// callers judging their age use the same one.
+func (c *ShardCollector) Clock() Clock {
+	return c.cfg.Clock
+}
+
+// MeterProvider returns the provider the collector records into, so companion
+// collectors can share its exporter.
+func (c *ShardCollector) MeterProvider() metric.MeterProvider {
+	return c.meterProvider
+}
+
+func (c *ShardCollector) registerInstruments() error {
 	shardStoreSize, err := c.meter.Float64ObservableGauge(
 		"opensearch.shard.store.size",
-		metric.WithDescription("Size of the shard store in bytes"),
-		metric.WithUnit("bytes"),
+		metric.WithDescription("Size of the shard store"),
+		metric.WithUnit(string(c.cfg.StoreUnit)),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create store size gauge: %w", err)
 	}
 
-	_, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
-		shards, err := c.fetchShardInfo(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to fetch shard info: %w", err)
+	shardDocsCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.shard.docs.count",
+		metric.WithDescription("Number of documents in the shard"),
+		metric.WithUnit("{documents}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create docs count gauge: %w", err)
+	}
+
+	shardState, err := c.meter.Int64ObservableGauge(
+		"opensearch.shard.state",
+		metric.WithDescription("Number of shards with these attributes, labelled with their current state"),
+		metric.WithUnit("{shards}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create shard state gauge: %w", err)
+	}
+
+	c.scrapeErrors, err = c.meter.Int64Counter(
+		"opensearch.collector.scrape.errors",
+		metric.WithDescription("Number of scrape failures, by reason: http, status, decode or parse"),
+		metric.WithUnit("{errors}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create scrape errors counter: %w", err)
+	}
+
+	c.scrapeDuration, err = c.meter.Float64Histogram(
+		"opensearch.collector.scrape.duration",
+		metric.WithDescription("Time taken to fetch and parse shard information"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create scrape duration histogram: %w", err)
+	}
+
+	c.storeSizes, err = c.meter.Float64Histogram(
+		storeSizeDistribution,
+		metric.WithDescription("Distribution of shard store sizes, recorded once per shard on every successful scrape"),
+		metric.WithUnit(string(c.cfg.StoreUnit)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create store size histogram: %w", err)
+	}
+
+	c.otelErrors, err = c.meter.Int64Counter(
+		"opensearch.collector.export.errors",
+		metric.WithDescription("Number of errors reported by the OpenTelemetry SDK, mostly failed exports"),
+		metric.WithUnit("{errors}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create export errors counter: %w", err)
+	}
+
+	c.missingIndices, err = c.meter.Int64Counter(
+		"opensearch.collector.index.missing",
+		metric.WithDescription("Number of times a configured index was not found and skipped"),
+		metric.WithUnit("{indices}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create missing index counter: %w", err)
+	}
+
+	lastSuccessTimestamp, err := c.meter.Float64ObservableGauge(
+		"opensearch.collector.last_success.timestamp",
+		metric.WithDescription("Unix time of the last successful shard scrape"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create last success gauge: %w", err)
+	}
+
+	segmentsCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.shard.segments.count",
+		metric.WithDescription("Number of Lucene segments in the shard; only reported when the segments.count column is requested"),
+		metric.WithUnit("{segments}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create segments count gauge: %w", err)
+	}
+
+	memoryGauges, err := c.newMemoryGauges()
+	if err != nil {
+		return err
+	}
+
+	if err := c.registerBuildInfo(); err != nil {
+		return err
+	}
+
+	seriesCount, err := c.meter.Int64ObservableGauge(
+		"opensearch.collector.series.count",
+		metric.WithDescription("Number of distinct attribute sets observed for the per-shard metrics in the last export, to watch cardinality"),
+		metric.WithUnit("{series}"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create series count gauge: %w", err)
+	}
+
+	instruments := []metric.Observable{shardStoreSize, shardDocsCount, shardState, segmentsCount, lastSuccessTimestamp, seriesCount}
+	for _, gauge := range memoryGauges {
+		instruments = append(instruments, gauge)
+	}
+
+	_, err = c.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		_, span := c.tracer.Start(ctx, "opensearch.shards.observe")
+		defer span.End()
+
+		c.mu.RLock()
+		samples := c.snapshot.samples
+		lastSuccess := c.lastSuccess
+		c.mu.RUnlock()
+
+		if !lastSuccess.IsZero() {
+			o.ObserveFloat64(lastSuccessTimestamp, float64(lastSuccess.UnixNano())/float64(time.Second))
 		}
 
-		for _, shard := range shards {
-			sizeInBytes, err := convertStoreToBytes(shard.Store)
-			if err != nil {
-				return fmt.Errorf("failed to convert store size: %w", err)
-			}
+		// Every shard is reported here, including unassigned shards that
+		// have no store or document count. Those are counted by
+		// opensearch.shards.no_store.count instead of reporting 0 bytes.
+		// Each series is one attribute set, shared by all per-shard gauges.
+		allSeries := c.shardSeries(samples)
+		if !lastSuccess.IsZero() {
+			o.ObserveInt64(seriesCount, int64(len(allSeries)))
+		}
+		for _, series := range allSeries {
+			attrs := metric.WithAttributeSet(series.attrs)
 
-			attrs := []attribute.KeyValue{
-				attribute.String("index", shard.Index),
-				attribute.String("shard", shard.Shard),
-				attribute.String("prirep", shard.Prirep),
-				attribute.String("state", shard.State),
-				attribute.String("node", shard.Node),
-				attribute.String("ip", shard.IP),
+			o.ObserveInt64(shardState, series.shards, attrs)
+			if series.hasStore {
+				o.ObserveFloat64(shardStoreSize, c.storeValue(series.storeBytes), attrs)
+			}
+			if series.hasDocs {
+				o.ObserveInt64(shardDocsCount, series.docs, attrs)
+			}
+			if series.hasSegments {
+				o.ObserveInt64(segmentsCount, series.segments, attrs)
+			}
+			for i, value := range series.memory {
+				if value.ok {
+					o.ObserveFloat64(memoryGauges[i], value.bytes, attrs)
+				}
 			}
-
-			o.ObserveFloat64(shardStoreSize, sizeInBytes, metric.WithAttributes(attrs...))
 		}
 		return nil
-	}, shardStoreSize)
+	}, instruments...)
+	if err != nil {
+		return fmt.Errorf("failed to register callback: %w", err)
+	}
+
+	if err := c.registerAggregateInstruments(); err != nil {
+		return err
+	}
+	return c.registerStateAgeInstruments()
+}
 
+func shardAttributes(shard ShardInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("index", shard.Index),
+		attribute.String("shard", shard.Shard),
+		attribute.String("prirep", shard.Prirep),
+		attribute.String("state", shard.State),
+		attribute.String("node", shard.Node),
+		attribute.String("ip", shard.IP),
+	}
+}
+
+// RelocationNodes splits the node column of a relocating shard, which
+// _cat/shards reports as "source -> target-ip target-id target", into the
+// source and target node names. ok is false for shards that aren't moving.
+func (s ShardInfo) RelocationNodes() (source, target string, ok bool) {
+	source, rest, found := strings.Cut(s.Node, "->")
+	if !found {
+		return "", "", false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(source), fields[len(fields)-1], true
+}
+
+// unassignedIP is the ip attribute of shards that are not allocated to any
+// node, so they don't share an empty value with malformed rows.
+const unassignedIP = unassignedNode
+
+// NodeIP returns the ip column as a single address in canonical form. Only
+// the first of several addresses is kept, and a value that isn't an address
+// is returned trimmed but otherwise as is. Unassigned shards, which report
+// no ip, return "_unassigned".
+func (s ShardInfo) NodeIP() string {
+	fields := strings.FieldsFunc(s.IP, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return unassignedIP
+	}
+	addr, err := netip.ParseAddr(strings.Trim(fields[0], "[]"))
+	if err != nil {
+		return fields[0]
+	}
+	return addr.Unmap().String()
+}
+
+// DocsCount parses the docs column. Shards that report no count, such as
+// unassigned shards, return 0.
+func (s ShardInfo) DocsCount() (int64, error) {
+	docs := strings.TrimSpace(s.Docs)
+	if docs == "" {
+		return 0, nil
+	}
+	count, err := strconv.ParseInt(docs, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid docs count %q: %w", s.Docs, err)
+	}
+	return count, nil
+}
+
+// DocsDeletedCount parses the docs.deleted column. Shards that report no
+// count, and clusters without the column, return 0.
+func (s ShardInfo) DocsDeletedCount() (int64, error) {
+	deleted := strings.TrimSpace(s.DocsDeleted)
+	if deleted == "" {
+		return 0, nil
+	}
+	count, err := strconv.ParseInt(deleted, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid deleted docs count %q: %w", s.DocsDeleted, err)
+	}
+	return count, nil
+}
+
+// StoreBytes converts the store column to bytes. It understands both plain
+// byte counts and human readable sizes such as "1.5gb"; shards that report no
+// store return 0.
+func (s ShardInfo) StoreBytes() (float64, error) {
+	return convertStoreToBytes(s.Store)
+}
+
+// shardSample is a ShardInfo with its numeric values parsed once per scrape.
+type shardSample struct {
+	ShardInfo
+
+	storeBytes  float64
+	hasStore    bool
+	docs        int64
+	hasDocs     bool
+	docsDeleted int64
+	hasDeleted  bool
+	memory      []sizeValue
+	segments    int64
+	hasSegments bool
+
+	// relocationTarget is the node a RELOCATING shard is moving to. Node
+	// then holds only the source node.
+	relocationTarget string
+}
+
+// CollectMetrics fetches the current shard information and stores it for the
+// next export. Instruments are registered once in NewShardCollector, so this
+// is safe to call on every tick.
+//
+// An error is returned only when shard information could not be fetched.
+// Shards with unparseable values are logged, counted and skipped.
+func (c *ShardCollector) CollectMetrics(ctx context.Context) error {
+	_, err := c.CollectOnce(ctx)
 	return err
 }
 
-func (c *ShardCollector) fetchShardInfo(ctx context.Context) ([]ShardInfo, error) {
-	var allShards []ShardInfo
+// CollectOnce performs a single synchronous scrape like CollectMetrics and
+// returns the shards that will be reported on the next export.
+func (c *ShardCollector) CollectOnce(ctx context.Context) ([]ShardInfo, error) {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	ctx, span := c.tracer.Start(ctx, "opensearch.shards.collect",
+		trace.WithAttributes(attribute.Int("opensearch.indices.count", len(c.cfg.Indices))))
+	defer span.End()
 
-	indices := []string{"otlp-metrics", "otlp-logs"}
+	start := time.Now()
+	defer func() {
+		c.scrapeDuration.Record(ctx, time.Since(start).Seconds())
+	}()
 
-	for _, index := range indices {
-		url := fmt.Sprintf("%s/_cat/shards/%s?format=json", c.endpoint, index)
+	fail := func(err error) ([]ShardInfo, error) {
+		c.scrapeErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", errorReason(err))))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "fetch failed")
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+		return nil, err
+	}
 
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	shards, err := c.fetchShardInfo(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("failed to fetch shard info: %w", err))
+	}
+	var stats map[string]indexStoreStats
+	if c.cfg.SizeSource == SizeSourceStats {
+		stats, err = c.fetchStoreStats(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
+			return fail(fmt.Errorf("failed to fetch index stats: %w", err))
 		}
+	}
+	var docs map[string]indexDocsStats
+	if c.cfg.DocsStats {
+		docs, err = c.fetchDocsStats(ctx)
+		if err != nil {
+			return fail(fmt.Errorf("failed to fetch index document stats: %w", err))
+		}
+	}
+	shards = c.filterShards(shards)
+	span.SetAttributes(attribute.Int("opensearch.shards.count", len(shards)))
+
+	samples := make([]shardSample, 0, len(shards))
+	for _, shard := range shards {
+		samples = append(samples, c.parseShard(ctx, shard))
+	}
 
-		resp, err := c.client.Do(req)
+	now := c.cfg.Clock.Now()
+	c.mu.RLock()
+	previous := c.snapshot
+	c.mu.RUnlock()
+	snap := newSnapshot(samples, previous, now)
+	if stats != nil {
+		snap.applyStoreStats(stats)
+	}
+	if docs != nil {
+		snap.applyDocsStats(docs)
+	} else if missingDocsDeleted(samples) {
+		c.fallBackToDeletedDocsStats(ctx, snap)
+	}
+
+	c.mu.Lock()
+	c.snapshot = snap
+	c.lastSuccess = now
+	c.lastErr = nil
+	c.mu.Unlock()
+
+	// Recorded here rather than in the callback, so every scrape contributes
+	// each shard exactly once however often the readers collect.
+	for _, sample := range samples {
+		if sample.hasStore {
+			c.storeSizes.Record(ctx, c.storeValue(sample.storeBytes))
+		}
+	}
+
+	c.cfg.Logger.Debug("Collected shards", "host", c.client.host(), "shards", len(shards))
+	return shards, nil
+}
+
+// FetchShards returns the shards of the configured indices as reported by
+// OpenSearch, after the index, state and node filters. Unlike CollectOnce it
+// records nothing and leaves the exported metrics untouched.
+func (c *ShardCollector) FetchShards(ctx context.Context) ([]ShardInfo, error) {
+	ctx, cancel := c.client.withScrapeTimeout(ctx)
+	defer cancel()
+
+	shards, err := c.fetchShardInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch shard info: %w", err)
+	}
+	return c.filterShards(shards), nil
+}
+
+// filterShards drops shards excluded by the index, state and node filters.
+func (c *ShardCollector) filterShards(shards []ShardInfo) []ShardInfo {
+	kept := shards[:0]
+	for _, shard := range shards {
+		if c.indexFilter.match(shard.Index) && c.stateSelected(shard.State) && c.nodeFilter.match(shard) {
+			kept = append(kept, shard)
+		}
+	}
+	return kept
+}
+
+// LastScrape returns when CollectMetrics last succeeded and the error of the
+// most recent call, which is nil if it succeeded. The time is zero until the
+// first successful scrape.
+func (c *ShardCollector) LastScrape() (time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSuccess, c.lastErr
+}
+
+func (c *ShardCollector) parseShard(ctx context.Context, shard ShardInfo) shardSample {
+	sample := shardSample{ShardInfo: shard}
+	sample.IP = shard.NodeIP()
+	if source, target, ok := shard.RelocationNodes(); ok {
+		sample.Node, sample.relocationTarget = source, target
+	}
+
+	// Unassigned shards report no store, which is kept apart from a genuine
+	// 0 byte store so it doesn't look like an empty shard.
+	if strings.TrimSpace(shard.Store) != "" {
+		sizeInBytes, err := c.parseStore(shard)
 		if err != nil {
-			return nil, fmt.Errorf("failed to execute request: %w", err)
+			c.recordParseError(ctx, shard, "store", err)
+		} else {
+			sample.storeBytes, sample.hasStore = sizeInBytes, true
 		}
-		defer resp.Body.Close()
+	}
 
-		var shards []ShardInfo
-		if err := json.NewDecoder(resp.Body).Decode(&shards); err != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", err)
+	// Unassigned shards report no document count.
+	if strings.TrimSpace(shard.Docs) != "" {
+		count, err := shard.DocsCount()
+		if err != nil {
+			c.recordParseError(ctx, shard, "docs", err)
+		} else {
+			sample.docs, sample.hasDocs = count, true
 		}
+	}
+	if strings.TrimSpace(shard.DocsDeleted) != "" {
+		count, err := shard.DocsDeletedCount()
+		if err != nil {
+			c.recordParseError(ctx, shard, "docs.deleted", err)
+		} else {
+			sample.docsDeleted, sample.hasDeleted = count, true
+		}
+	}
+
+	// Shards without segments, or scrapes that didn't request the column,
+	// report an empty value.
+	if segments := strings.TrimSpace(shard.SegmentsCount); segments != "" {
+		count, err := strconv.ParseInt(segments, 10, 64)
+		if err != nil {
+			c.recordParseError(ctx, shard, "segments.count", err)
+		} else {
+			sample.segments, sample.hasSegments = count, true
+		}
+	}
+
+	sample.memory = c.parseMemory(ctx, shard)
+	return sample
+}
+
+// parseStore converts the store column of shard to bytes. With
+// Config.RawBytes the value should already be a byte count, but human
+// readable sizes are still understood in case the endpoint ignored bytes=b.
+func (c *ShardCollector) parseStore(shard ShardInfo) (float64, error) {
+	if c.cfg.RawBytes {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(shard.Store), 64); err == nil {
+			return value, nil
+		}
+	}
+	return shard.StoreBytes()
+}
+
+func (c *ShardCollector) recordParseError(ctx context.Context, shard ShardInfo, field string, err error) {
+	c.cfg.Logger.Warn("Skipping unparseable shard value",
+		"index", shard.Index,
+		"shard", shard.Shard,
+		"prirep", shard.Prirep,
+		"field", field,
+		"error", err,
+	)
+	c.scrapeErrors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("reason", "parse"),
+		attribute.String("field", field),
+	))
+}
 
+// fetchShardInfo fetches the shards of all configured indices with a single
+// _cat/shards request. A missing concrete index makes OpenSearch reject the
+// whole comma separated list, so in that case it falls back to one request
+// per index and the indices that do exist still report.
+func (c *ShardCollector) fetchShardInfo(ctx context.Context) ([]ShardInfo, error) {
+	if err := c.nodeFilter.resolve(ctx, c.client); err != nil {
+		return nil, err
+	}
+
+	targets, ok, err := c.aliases.targets(ctx, c.client, c.cfg.Indices)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	shards, err := c.fetchTarget(ctx, strings.Join(targets, ","))
+	switch {
+	case err == nil:
+		return shards, nil
+	case !isNotFound(err):
+		return nil, err
+	case len(targets) <= 1:
+		// A missing index or a pattern that matches no indices is not an
+		// error, it just has no shards.
+		if len(targets) == 1 {
+			c.recordMissingIndex(ctx, targets[0])
+		}
+		return nil, nil
+	}
+
+	return c.fetchEach(ctx, targets)
+}
+
+// recordMissingIndex logs and counts a configured index that OpenSearch
+// doesn't know, which is skipped so the other indices are still reported.
+func (c *ShardCollector) recordMissingIndex(ctx context.Context, index string) {
+	c.cfg.Logger.Warn("Index not found, skipping", "index", index)
+	c.missingIndices.Add(ctx, 1, metric.WithAttributes(attribute.String("index", index)))
+}
+
+// fetchEach fetches targets concurrently, bounded by Config.Concurrency.
+// Results are kept in target order and every failure other than a missing
+// index is reported.
+func (c *ShardCollector) fetchEach(ctx context.Context, targets []string) ([]ShardInfo, error) {
+	results := make([][]ShardInfo, len(targets))
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, c.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = c.fetchTarget(ctx, target)
+			if isNotFound(errs[i]) {
+				c.recordMissingIndex(ctx, target)
+				errs[i] = nil
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var allShards []ShardInfo
+	for _, shards := range results {
 		allShards = append(allShards, shards...)
 	}
 
 	return allShards, nil
 }
 
+// fetchTarget fetches the shards of a comma separated list of indices or
+// patterns. An empty target fetches the shards of all indices.
+func (c *ShardCollector) fetchTarget(ctx context.Context, target string) ([]ShardInfo, error) {
+	catPath := "_cat/shards"
+	if target != "" {
+		catPath += "/" + target
+	}
+	query := "format=json&h=" + c.columns()
+	if c.cfg.IncludeHidden {
+		query += "&expand_wildcards=all"
+	}
+	if c.cfg.RawBytes {
+		query += "&bytes=b"
+	}
+
+	var shards []ShardInfo
+	if err := c.client.getJSON(ctx, catPath, query, &shards); err != nil {
+		return nil, err
+	}
+
+	if !c.cfg.IncludeHidden {
+		visible := shards[:0]
+		for _, shard := range shards {
+			if c.visible(shard.Index) {
+				visible = append(visible, shard)
+			}
+		}
+		shards = visible
+	}
+
+	return shards, nil
+}
+
+// visible reports whether shards of index are collected when hidden indices
+// are excluded: dot-prefixed indices are only kept if they were named
+// explicitly, resolved from an alias, or matched by a pattern that itself
+// starts with a dot.
+func (c *ShardCollector) visible(index string) bool {
+	if !strings.HasPrefix(index, ".") || c.aliases.contains(index) {
+		return true
+	}
+	for _, target := range c.cfg.Indices {
+		if target == index {
+			return true
+		}
+		if isIndexPattern(target) && strings.HasPrefix(target, ".") {
+			if ok, _ := path.Match(target, index); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stateSelected reports whether shards in state pass the configured
+// IncludeStates and ExcludeStates filters.
+func (c *ShardCollector) stateSelected(state string) bool {
+	if len(c.cfg.IncludeStates) > 0 && !containsFold(c.cfg.IncludeStates, state) {
+		return false
+	}
+	return !containsFold(c.cfg.ExcludeStates, state)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeUnits maps the size suffixes used by the _cat APIs to their byte
+// multipliers. Multi-letter suffixes come first so "kb" isn't matched as "b".
+var storeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"pb", 1024 * 1024 * 1024 * 1024 * 1024},
+	{"tb", 1024 * 1024 * 1024 * 1024},
+	{"gb", 1024 * 1024 * 1024},
+	{"mb", 1024 * 1024},
+	{"kb", 1024},
+	{"b", 1},
+}
+
 func convertStoreToBytes(store string) (float64, error) {
-	store = strings.TrimSpace(store)
+	store = strings.ToLower(strings.TrimSpace(store))
 	if store == "" {
 		return 0, nil
 	}
 
-	var multiplier float64
-	switch {
-	case strings.HasSuffix(store, "kb"):
-		multiplier = 1024
-		store = strings.TrimSuffix(store, "kb")
-	case strings.HasSuffix(store, "mb"):
-		multiplier = 1024 * 1024
-		store = strings.TrimSuffix(store, "mb")
-	case strings.HasSuffix(store, "gb"):
-		multiplier = 1024 * 1024 * 1024
-		store = strings.TrimSuffix(store, "gb")
-	default:
-		return 0, fmt.Errorf("unknown size unit in: %s", store)
+	// A bare number is already in bytes.
+	multiplier := 1.0
+	for _, unit := range storeUnits {
+		if strings.HasSuffix(store, unit.suffix) {
+			multiplier = unit.multiplier
+			store = strings.TrimSuffix(store, unit.suffix)
+			break
+		}
 	}
 
 	value, err := strconv.ParseFloat(store, 64)
@@ -174,6 +886,51 @@ func convertStoreToBytes(store string) (float64, error) {
 	return value * multiplier, nil
 }
 
+// ErrFlushTimeout is returned, wrapped, by Shutdown when the final export did
+// not complete within Config.FlushTimeout.
+var ErrFlushTimeout = errors.New("flush timed out")
+
+// ForceFlush exports the metrics collected so far without waiting for the
+// next Config.ExportInterval tick, which is not reset. It is bounded and
+// reports errors like Shutdown.
+func (c *ShardCollector) ForceFlush(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.FlushTimeout)
+	defer cancel()
+
+	err := c.meterProvider.ForceFlush(ctx)
+	if c.tracerProvider != nil {
+		err = errors.Join(err, c.tracerProvider.ForceFlush(ctx))
+	}
+	return c.flushError(err)
+}
+
+func (c *ShardCollector) flushError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w after %s: %w", ErrFlushTimeout, c.cfg.FlushTimeout, err)
+	default:
+		return fmt.Errorf("flush failed: %w", err)
+	}
+}
+
+// Shutdown exports the metrics collected so far and stops the exporters. The
+// final export is bounded by Config.FlushTimeout as well as ctx; a timeout is
+// reported as ErrFlushTimeout, any other export failure as a flush error.
 func (c *ShardCollector) Shutdown(ctx context.Context) error {
-	return c.meterProvider.Shutdown(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.FlushTimeout)
+	defer cancel()
+
+	// Shutting down a periodic reader collects and exports one last time, so
+	// no separate ForceFlush is needed.
+	err := c.meterProvider.Shutdown(ctx)
+	if c.tracerProvider != nil {
+		err = errors.Join(err, c.tracerProvider.Shutdown(ctx))
+	}
+	err = c.flushError(err)
+	if c.promServer != nil {
+		err = errors.Join(err, c.promServer.Shutdown(ctx))
+	}
+	return err
 }
@@ -0,0 +1,515 @@
+package opensearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// newTestServer starts a server running handler for the duration of the test.
+func newTestServer(t testing.TB, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestShardCollector returns a collector for a server running handler,
+// recording into a ManualReader.
+func newTestShardCollector(t testing.TB, handler http.Handler, opts ...Option) *ShardCollector {
+	t.Helper()
+	srv := newTestServer(t, handler)
+	opts = append(opts, WithOpenSearchEndpoint(srv.URL), WithReader(sdkmetric.NewManualReader()))
+	c, err := NewShardCollector(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+	return c
+}
+
+// catShardsHandler serves shards for /_cat/shards/<index> requests naming a
+// single index in shards. Comma separated lists get a 404 if any index is
+// unknown, as OpenSearch rejects the whole list.
+func catShardsHandler(shards map[string][]ShardInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var found []ShardInfo
+		for _, index := range strings.Split(strings.TrimPrefix(r.URL.Path, "/_cat/shards/"), ",") {
+			indexShards, ok := shards[index]
+			if !ok {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, `{"error":{"type":"index_not_found_exception","index":%q},"status":404}`, index)
+				return
+			}
+			found = append(found, indexShards...)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(found)
+	}
+}
+
+// bodyTracker counts the response bodies that are still open.
+type bodyTracker struct {
+	rt http.RoundTripper
+
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+	total   int
+}
+
+func (b *bodyTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := b.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.open++
+	b.total++
+	b.maxOpen = max(b.maxOpen, b.open)
+	b.mu.Unlock()
+	resp.Body = &trackedBody{ReadCloser: resp.Body, tracker: b}
+	return resp, nil
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	tracker *bodyTracker
+	once    sync.Once
+}
+
+func (t *trackedBody) Close() error {
+	t.once.Do(func() {
+		t.tracker.mu.Lock()
+		t.tracker.open--
+		t.tracker.mu.Unlock()
+	})
+	return t.ReadCloser.Close()
+}
+
+func TestConvertStoreToBytes(t *testing.T) {
+	tests := []struct {
+		store   string
+		want    float64
+		wantErr bool
+	}{
+		{store: "", want: 0},
+		{store: "   ", want: 0},
+		{store: "512", want: 512},
+		{store: "512b", want: 512},
+		{store: "1kb", want: 1 << 10},
+		{store: "1.5kb", want: 1536},
+		{store: "10mb", want: 10 << 20},
+		{store: "2.5gb", want: 2.5 * (1 << 30)},
+		{store: "1tb", want: 1 << 40},
+		{store: "0.5pb", want: 1 << 49},
+		{store: "1.5GB", want: 1.5 * (1 << 30)},
+		{store: " 3Mb ", want: 3 << 20},
+		{store: "0b", want: 0},
+		{store: "-", wantErr: true},
+		{store: "kb", wantErr: true},
+		{store: "12qb", wantErr: true},
+		{store: "1.2.3mb", wantErr: true},
+		{store: "garbage", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := convertStoreToBytes(tt.store)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("convertStoreToBytes(%q) = %v, want an error", tt.store, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("convertStoreToBytes(%q): %v", tt.store, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("convertStoreToBytes(%q) = %v, want %v", tt.store, got, tt.want)
+		}
+	}
+}
+
+func TestConvertStoreToBytesEveryUnit(t *testing.T) {
+	// Each suffix must parse to its own multiplier in either case, which
+	// also catches a shorter suffix shadowing a longer one.
+	for _, unit := range storeUnits {
+		for _, store := range []string{"2" + unit.suffix, "2" + strings.ToUpper(unit.suffix)} {
+			got, err := convertStoreToBytes(store)
+			if err != nil {
+				t.Errorf("convertStoreToBytes(%q): %v", store, err)
+				continue
+			}
+			if want := 2 * unit.multiplier; got != want {
+				t.Errorf("convertStoreToBytes(%q) = %v, want %v", store, got, want)
+			}
+		}
+	}
+	if got, err := convertStoreToBytes("2048"); err != nil || got != 2048 {
+		t.Errorf("convertStoreToBytes(%q) = %v, %v, want 2048 bytes", "2048", got, err)
+	}
+}
+
+func TestFetchEachClosesBodies(t *testing.T) {
+	shards := make(map[string][]ShardInfo)
+	indices := []string{"missing"}
+	for i := range 30 {
+		index := fmt.Sprintf("logs-%02d", i)
+		shards[index] = []ShardInfo{{Index: index, Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb"}}
+		indices = append(indices, index)
+	}
+	c := newTestShardCollector(t, catShardsHandler(shards), WithConfig(Config{Concurrency: 1}), WithIndices(indices...))
+	tracker := &bodyTracker{rt: c.client.http.Transport}
+	c.client.http.Transport = tracker
+
+	// The missing index makes the combined request fail, so every index is
+	// then fetched on its own.
+	got, err := c.FetchShards(context.Background())
+	if err != nil {
+		t.Fatalf("FetchShards: %v", err)
+	}
+	if len(got) != 30 {
+		t.Errorf("got %d shards, want 30", len(got))
+	}
+	if want := 1 + len(indices); tracker.total != want {
+		t.Errorf("made %d requests, want %d", tracker.total, want)
+	}
+	if tracker.open != 0 {
+		t.Errorf("%d response bodies left open", tracker.open)
+	}
+	if tracker.maxOpen > 1 {
+		t.Errorf("%d response bodies open at once with concurrency 1", tracker.maxOpen)
+	}
+}
+
+// discardLogger keeps expected warnings out of test and benchmark output.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// largeShardFixture returns indices with a primary and a replica for each of
+// shards shards, with the store and docs columns filled in.
+func largeShardFixture(indices, shards int) map[string][]ShardInfo {
+	fixture := make(map[string][]ShardInfo, indices)
+	for i := range indices {
+		index := fmt.Sprintf("logs-%04d", i)
+		for s := range shards {
+			for _, prirep := range []string{"p", "r"} {
+				fixture[index] = append(fixture[index], ShardInfo{
+					Index:       index,
+					Shard:       strconv.Itoa(s),
+					Prirep:      prirep,
+					State:       "STARTED",
+					Docs:        strconv.Itoa(1000 * (s + 1)),
+					DocsDeleted: strconv.Itoa(s),
+					Store:       fmt.Sprintf("%d.%dmb", s+1, i%10),
+					IP:          fmt.Sprintf("10.0.%d.%d", s%4, i%250),
+					Node:        fmt.Sprintf("node-%d", (i+s)%7),
+				})
+			}
+		}
+	}
+	return fixture
+}
+
+func BenchmarkParseShard(b *testing.B) {
+	c := newTestShardCollector(b, catShardsHandler(nil))
+	var shards []ShardInfo
+	for _, indexShards := range largeShardFixture(10, 10) {
+		shards = append(shards, indexShards...)
+	}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.parseShard(ctx, shards[i%len(shards)])
+	}
+}
+
+// BenchmarkCollectOnce scrapes 200 indices of 10 shards each from a server
+// that adds latency to every request, so the cost of each round trip shows
+// against the single combined _cat/shards request.
+func BenchmarkCollectOnce(b *testing.B) {
+	fixture := largeShardFixture(200, 10)
+	handler := catShardsHandler(fixture)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		handler(w, r)
+	})
+
+	indices := make([]string, 0, len(fixture)+1)
+	for index := range fixture {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	// A missing index makes OpenSearch reject the combined request, so every
+	// index is fetched on its own.
+	perIndex := append([]string{"missing"}, indices...)
+
+	benchmarks := []struct {
+		name        string
+		indices     []string
+		concurrency int
+	}{
+		{name: "single request", indices: indices, concurrency: 1},
+		{name: "per index/concurrency=1", indices: perIndex, concurrency: 1},
+		{name: "per index/concurrency=8", indices: perIndex, concurrency: 8},
+		{name: "per index/concurrency=32", indices: perIndex, concurrency: 32},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			c := newTestShardCollector(b, slow, WithConfig(Config{Concurrency: bm.concurrency, Logger: discardLogger}), WithIndices(bm.indices...))
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.CollectOnce(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchShardInfoCombinesIndices(t *testing.T) {
+	shards := map[string][]ShardInfo{
+		"logs":    {{Index: "logs", Shard: "0", Prirep: "p", State: "STARTED"}},
+		"metrics": {{Index: "metrics", Shard: "0", Prirep: "p", State: "STARTED"}},
+	}
+	tests := []struct {
+		name         string
+		indices      []string
+		wantRequests []string
+		wantIndices  []string
+	}{
+		{
+			name:         "all indices exist",
+			indices:      []string{"logs", "metrics"},
+			wantRequests: []string{"/_cat/shards/logs,metrics"},
+			wantIndices:  []string{"logs", "metrics"},
+		},
+		{
+			name:         "one index missing",
+			indices:      []string{"logs", "gone", "metrics"},
+			wantRequests: []string{"/_cat/shards/logs,gone,metrics", "/_cat/shards/gone", "/_cat/shards/logs", "/_cat/shards/metrics"},
+			wantIndices:  []string{"logs", "metrics"},
+		},
+		{
+			name:         "only index missing",
+			indices:      []string{"gone"},
+			wantRequests: []string{"/_cat/shards/gone"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests []string
+			)
+			handler := catShardsHandler(shards)
+			c := newTestShardCollector(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.URL.Path)
+				mu.Unlock()
+				handler(w, r)
+			}), WithIndices(tt.indices...))
+
+			got, err := c.fetchShardInfo(context.Background())
+			if err != nil {
+				t.Fatalf("fetchShardInfo: %v", err)
+			}
+			var indices []string
+			for _, shard := range got {
+				indices = append(indices, shard.Index)
+			}
+			if !slices.Equal(indices, tt.wantIndices) {
+				t.Errorf("got shards of %v, want %v", indices, tt.wantIndices)
+			}
+			// The per-index fallback runs concurrently, so only the first
+			// request is ordered.
+			sort.Strings(requests[min(1, len(requests)):])
+			sort.Strings(tt.wantRequests[min(1, len(tt.wantRequests)):])
+			if !slices.Equal(requests, tt.wantRequests) {
+				t.Errorf("requests = %v, want %v", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNewShardCollectorValidatesEndpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		collector string
+		wantErr   string
+	}{
+		{name: "valid", endpoint: "http://localhost:9200", collector: "localhost:4317"},
+		{name: "valid list with prefix", endpoint: "https://a:9200, https://gw/opensearch", collector: "[::1]:4317"},
+		{name: "missing scheme", endpoint: "localhost:9200", collector: "localhost:4317", wantErr: `invalid OpenSearch endpoint "localhost:9200": scheme must be http or https`},
+		{name: "unsupported scheme", endpoint: "ftp://localhost", collector: "localhost:4317", wantErr: "scheme must be http or https"},
+		{name: "missing host", endpoint: "http://", collector: "localhost:4317", wantErr: "missing host"},
+		{name: "query", endpoint: "http://localhost:9200?pretty", collector: "localhost:4317", wantErr: "must not contain a query or fragment"},
+		{name: "trailing junk", endpoint: "http://localhost:9200/#junk", collector: "localhost:4317", wantErr: "must not contain a query or fragment"},
+		{name: "bad entry in list", endpoint: "http://a:9200,b:9200", collector: "localhost:4317", wantErr: `invalid OpenSearch endpoint "b:9200"`},
+		{name: "collector URL", endpoint: "http://localhost:9200", collector: "http://collector:4317", wantErr: `invalid OTLP endpoint "http://collector:4317": must be host:port`},
+		{name: "collector without port", endpoint: "http://localhost:9200", collector: "collector", wantErr: "must be host:port"},
+		{name: "collector without host", endpoint: "http://localhost:9200", collector: ":4317", wantErr: "missing host"},
+		{name: "collector port out of range", endpoint: "http://localhost:9200", collector: "collector:70000", wantErr: `invalid port "70000"`},
+		{name: "collector named port", endpoint: "http://localhost:9200", collector: "collector:otlp", wantErr: `invalid port "otlp"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewShardCollector(context.Background(),
+				WithConfig(Config{FlushTimeout: 10 * time.Millisecond, Logger: discardLogger}),
+				WithOpenSearchEndpoint(tt.endpoint),
+				WithOTLPEndpoint(tt.collector),
+			)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewShardCollector: %v", err)
+				}
+				_ = c.Shutdown(context.Background())
+				return
+			}
+			if err == nil {
+				_ = c.Shutdown(context.Background())
+				t.Fatalf("NewShardCollector succeeded, want %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShardInfoDocsCount(t *testing.T) {
+	tests := []struct {
+		docs    string
+		want    int64
+		wantErr bool
+	}{
+		{docs: "", want: 0},
+		{docs: " ", want: 0},
+		{docs: "0", want: 0},
+		{docs: "12345", want: 12345},
+		{docs: " 42 ", want: 42},
+		{docs: "9223372036854775807", want: 9223372036854775807},
+		{docs: "9223372036854775808", wantErr: true},
+		{docs: "1.5", wantErr: true},
+		{docs: "-", wantErr: true},
+		{docs: "null", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ShardInfo{Docs: tt.docs}.DocsCount()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("DocsCount(%q) = %d, want an error", tt.docs, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("DocsCount(%q) = %d, %v, want %d", tt.docs, got, err, tt.want)
+		}
+	}
+
+	// JSON null leaves the field empty, which counts as no documents.
+	var shard ShardInfo
+	if err := json.Unmarshal([]byte(`{"docs":null}`), &shard); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := shard.DocsCount(); err != nil || got != 0 {
+		t.Errorf("DocsCount of null docs = %d, %v, want 0", got, err)
+	}
+}
+
+func TestShardInfoDocsDeletedCount(t *testing.T) {
+	tests := []struct {
+		deleted string
+		want    int64
+		wantErr bool
+	}{
+		{deleted: "", want: 0},
+		{deleted: " ", want: 0},
+		{deleted: "0", want: 0},
+		{deleted: " 17 ", want: 17},
+		{deleted: "1.5", wantErr: true},
+		{deleted: "-", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ShardInfo{DocsDeleted: tt.deleted}.DocsDeletedCount()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("DocsDeletedCount(%q) = %d, want an error", tt.deleted, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("DocsDeletedCount(%q) = %d, %v, want %d", tt.deleted, got, err, tt.want)
+		}
+	}
+}
+
+func TestShardInfoStoreBytes(t *testing.T) {
+	tests := []struct {
+		store   string
+		want    float64
+		wantErr bool
+	}{
+		{store: "", want: 0},
+		{store: "0b", want: 0},
+		{store: "2048", want: 2048},
+		{store: "4kb", want: 4 << 10},
+		{store: "1.25GB", want: 1.25 * (1 << 30)},
+		{store: "3tb", want: 3 << 40},
+		{store: "n/a", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ShardInfo{Store: tt.store}.StoreBytes()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("StoreBytes(%q) = %v, want an error", tt.store, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("StoreBytes(%q) = %v, %v, want %v", tt.store, got, err, tt.want)
+		}
+	}
+}
+
+func TestShardInfoNodeIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "", want: unassignedIP},
+		{ip: "   ", want: unassignedIP},
+		{ip: "10.0.0.1", want: "10.0.0.1"},
+		{ip: " 10.0.0.1 ", want: "10.0.0.1"},
+		{ip: "10.0.0.1,10.0.0.2", want: "10.0.0.1"},
+		{ip: "10.0.0.1 10.0.0.2", want: "10.0.0.1"},
+		{ip: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{ip: "[2001:db8:0:0::1]", want: "2001:db8::1"},
+		{ip: "2001:DB8::1", want: "2001:db8::1"},
+		{ip: "node-1.internal", want: "node-1.internal"},
+	}
+	for _, tt := range tests {
+		if got := (ShardInfo{IP: tt.ip}).NodeIP(); got != tt.want {
+			t.Errorf("NodeIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
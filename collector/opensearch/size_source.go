@@ -0,0 +1,82 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SizeSource selects where index store sizes come from.
+type SizeSource string
+
+const (
+	// SizeSourceCat sums the store column of _cat/shards, which OpenSearch
+	// rounds unless Config.RawBytes is set. It needs no extra request.
+	SizeSourceCat SizeSource = "cat"
+	// SizeSourceStats reads exact primary and total store sizes per index
+	// from the _stats API, at the cost of one more request per scrape.
+	SizeSourceStats SizeSource = "stats"
+)
+
+func (s SizeSource) validate() error {
+	switch s {
+	case SizeSourceCat, SizeSourceStats:
+		return nil
+	default:
+		return fmt.Errorf("unknown size source %q", s)
+	}
+}
+
+// storeStatsQuery trims the _stats response to the store sizes and skips
+// configured indices that don't exist.
+const storeStatsQuery = "ignore_unavailable=true&filter_path=indices.*.primaries.store.size_in_bytes,indices.*.total.store.size_in_bytes"
+
+type storeStats struct {
+	Store struct {
+		SizeInBytes float64 `json:"size_in_bytes"`
+	} `json:"store"`
+}
+
+type indexStoreStats struct {
+	Primaries storeStats `json:"primaries"`
+	Total     storeStats `json:"total"`
+}
+
+// fetchStoreStats fetches the exact store sizes of the configured indices.
+func (c *ShardCollector) fetchStoreStats(ctx context.Context) (map[string]indexStoreStats, error) {
+	var resp struct {
+		Indices map[string]indexStoreStats `json:"indices"`
+	}
+	if err := c.getIndexStats(ctx, "store", storeStatsQuery, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Indices, nil
+}
+
+// getIndexStats decodes _stats/<metrics> for the scraped indices into v,
+// which is left untouched when there is nothing to scrape.
+func (c *ShardCollector) getIndexStats(ctx context.Context, metrics, query string, v any) error {
+	targets, ok, err := c.aliases.targets(ctx, c.client, c.cfg.Indices)
+	if err != nil || !ok {
+		return err
+	}
+	statsPath := "_stats/" + metrics
+	if len(targets) > 0 {
+		statsPath = strings.Join(targets, ",") + "/" + statsPath
+	}
+	if c.cfg.IncludeHidden {
+		query += "&expand_wildcards=all"
+	}
+	return c.client.getJSON(ctx, statsPath, query, v)
+}
+
+// applyStoreStats replaces the index store sizes summed from _cat/shards
+// with the exact ones. Indices dropped by the filters stay dropped.
+func (s snapshot) applyStoreStats(stats map[string]indexStoreStats) {
+	for name, index := range s.indices {
+		if st, ok := stats[name]; ok {
+			index.primaryStoreBytes = st.Primaries.Store.SizeInBytes
+			index.totalStoreBytes = st.Total.Store.SizeInBytes
+		}
+	}
+}
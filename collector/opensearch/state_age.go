@@ -0,0 +1,158 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// shardKey identifies a shard copy across scrapes. Replicas of one shard are
+// told apart by a copy slot that trackPending keeps stable while the copy is
+// allocated and moved, so its node is not part of the key.
+type shardKey struct {
+	index  string
+	shard  string
+	prirep string
+	copy   int
+}
+
+// pendingShard records since when a shard copy has been seen outside
+// STARTED, and where it is now.
+type pendingShard struct {
+	state string
+	node  string
+	since time.Time
+}
+
+// trackPending returns the shard copies that are not STARTED in samples,
+// keeping the first-seen time from previous for copies that were already
+// pending, whatever their state or node now. Copies that became STARTED or
+// disappeared are dropped, so the map only ever holds pending copies.
+func trackPending(previous map[shardKey]pendingShard, samples []shardSample, now time.Time) map[shardKey]pendingShard {
+	type group struct{ index, shard, prirep string }
+
+	var order []group
+	copies := make(map[group][]pendingShard)
+	for _, sample := range samples {
+		if sample.State == "STARTED" {
+			continue
+		}
+		node := sample.Node
+		if node == "" {
+			node = unassignedNode
+		}
+		g := group{index: sample.Index, shard: sample.Shard, prirep: sample.Prirep}
+		if _, ok := copies[g]; !ok {
+			order = append(order, g)
+		}
+		copies[g] = append(copies[g], pendingShard{state: sample.State, node: node, since: now})
+	}
+
+	slots := make(map[group]map[int]pendingShard)
+	for key, shard := range previous {
+		g := group{index: key.index, shard: key.shard, prirep: key.prirep}
+		if _, ok := copies[g]; !ok {
+			continue
+		}
+		if slots[g] == nil {
+			slots[g] = make(map[int]pendingShard)
+		}
+		slots[g][key.copy] = shard
+	}
+
+	pending := make(map[shardKey]pendingShard)
+	for _, g := range order {
+		for slot, shard := range assignSlots(slots[g], copies[g]) {
+			pending[shardKey{index: g.index, shard: g.shard, prirep: g.prirep, copy: slot}] = shard
+		}
+	}
+	return pending
+}
+
+// assignSlots matches the pending copies of one shard to the slots they held
+// in the previous scrape, keeping the first-seen time of each match. A copy
+// is matched to a slot on the same node in the same state, then on the same
+// node, so a copy moving from INITIALIZING to RELOCATING keeps its slot. An
+// allocated copy is then matched to the slot of an UNASSIGNED copy, and the
+// rest to any slot left over. Copies left without a slot take the lowest
+// free one.
+func assignSlots(previous map[int]pendingShard, copies []pendingShard) map[int]pendingShard {
+	free := slices.Sorted(maps.Keys(previous))
+	assigned := make(map[int]pendingShard, len(copies))
+	matched := make([]bool, len(copies))
+	match := func(same func(prev, cur pendingShard) bool) {
+		for i, cur := range copies {
+			if matched[i] {
+				continue
+			}
+			for j, slot := range free {
+				if prev := previous[slot]; same(prev, cur) {
+					cur.since = prev.since
+					assigned[slot] = cur
+					matched[i] = true
+					free = slices.Delete(free, j, j+1)
+					break
+				}
+			}
+		}
+	}
+	match(func(prev, cur pendingShard) bool { return prev.node == cur.node && prev.state == cur.state })
+	match(func(prev, cur pendingShard) bool { return prev.node == cur.node && cur.node != unassignedNode })
+	match(func(prev, cur pendingShard) bool { return prev.node == unassignedNode })
+	match(func(prev, cur pendingShard) bool { return true })
+
+	slot := 0
+	for i, cur := range copies {
+		if matched[i] {
+			continue
+		}
+		for _, ok := assigned[slot]; ok; _, ok = assigned[slot] {
+			slot++
+		}
+		assigned[slot] = cur
+	}
+	return assigned
+}
+
+func (c *ShardCollector) registerStateAgeInstruments() error {
+	stateAge, err := c.meter.Float64ObservableGauge(
+		"opensearch.shard.state.age.seconds",
+		metric.WithDescription("Time since the shard was first seen in a state other than STARTED"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create state age gauge: %w", err)
+	}
+
+	_, err = c.meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		c.mu.RLock()
+		pending := c.snapshot.pending
+		c.mu.RUnlock()
+
+		now := c.cfg.Clock.Now()
+		for key, shard := range pending {
+			attrs := []attribute.KeyValue{
+				attribute.String("index", key.index),
+				attribute.String("shard", key.shard),
+				attribute.String("prirep", key.prirep),
+				attribute.String("node", shard.node),
+				attribute.String("state", shard.state),
+			}
+			if key.copy > 0 {
+				attrs = append(attrs, attribute.Int("copy", key.copy))
+			}
+			o.ObserveFloat64(stateAge, now.Sub(shard.since).Seconds(), metric.WithAttributes(attrs...))
+		}
+		return nil
+	}, stateAge)
+	if err != nil {
+		return fmt.Errorf("failed to register state age callback: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package opensearch
+
+import (
+	"testing"
+	"time"
+)
+
+func replicaSample(node, state string) shardSample {
+	return shardSample{ShardInfo: ShardInfo{Index: "logs", Shard: "0", Prirep: "r", State: state, Node: node}}
+}
+
+func replicaKey(copy int) shardKey {
+	return shardKey{index: "logs", shard: "0", prirep: "r", copy: copy}
+}
+
+// assertPending checks that pending holds exactly want.
+func assertPending(t *testing.T, step string, pending, want map[shardKey]pendingShard) {
+	t.Helper()
+	if len(pending) != len(want) {
+		t.Errorf("%s: got %d pending copies %v, want %d", step, len(pending), pending, len(want))
+	}
+	for key, w := range want {
+		got, ok := pending[key]
+		if !ok {
+			t.Errorf("%s: copy %d not pending", step, key.copy)
+			continue
+		}
+		if got.state != w.state || got.node != w.node || !got.since.Equal(w.since) {
+			t.Errorf("%s: copy %d is %s on %s since %s, want %s on %s since %s",
+				step, key.copy, got.state, got.node, got.since, w.state, w.node, w.since)
+		}
+	}
+}
+
+func TestTrackPendingKeepsReplicasApart(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+
+	// Two replicas of one shard go pending at different times and in
+	// different states; each keeps its own first-seen time.
+	first := trackPending(nil, []shardSample{
+		replicaSample("node-1", "INITIALIZING"),
+		replicaSample("", "UNASSIGNED"),
+	}, t0)
+	second := trackPending(first, []shardSample{
+		replicaSample("node-1", "INITIALIZING"),
+		replicaSample("", "UNASSIGNED"),
+		replicaSample("", "UNASSIGNED"),
+	}, t0.Add(time.Minute))
+	assertPending(t, "second scrape", second, map[shardKey]pendingShard{
+		replicaKey(0): {state: "INITIALIZING", node: "node-1", since: t0},
+		replicaKey(1): {state: "UNASSIGNED", node: unassignedNode, since: t0},
+		replicaKey(2): {state: "UNASSIGNED", node: unassignedNode, since: t0.Add(time.Minute)},
+	})
+
+	// The initializing copy starting leaves the unassigned ones alone.
+	third := trackPending(second, []shardSample{
+		replicaSample("node-1", "STARTED"),
+		replicaSample("", "UNASSIGNED"),
+		replicaSample("", "UNASSIGNED"),
+	}, t0.Add(2*time.Minute))
+	assertPending(t, "third scrape", third, map[shardKey]pendingShard{
+		replicaKey(1): {state: "UNASSIGNED", node: unassignedNode, since: t0},
+		replicaKey(2): {state: "UNASSIGNED", node: unassignedNode, since: t0.Add(time.Minute)},
+	})
+}
+
+func TestTrackPendingFollowsAllocation(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+
+	// A copy keeps its slot and first-seen time as it is allocated and
+	// moved, and only leaves once STARTED.
+	pending := trackPending(nil, []shardSample{replicaSample("", "UNASSIGNED")}, t0)
+	for i, sample := range []shardSample{
+		replicaSample("node-1", "INITIALIZING"),
+		replicaSample("node-1", "RELOCATING"),
+	} {
+		pending = trackPending(pending, []shardSample{sample}, t0.Add(time.Duration(i+1)*time.Minute))
+		assertPending(t, sample.State, pending, map[shardKey]pendingShard{
+			replicaKey(0): {state: sample.State, node: "node-1", since: t0},
+		})
+	}
+	pending = trackPending(pending, []shardSample{replicaSample("node-2", "STARTED")}, t0.Add(3*time.Minute))
+	assertPending(t, "STARTED", pending, nil)
+
+	// Pending again after starting counts from the new first sighting.
+	t1 := t0.Add(4 * time.Minute)
+	pending = trackPending(pending, []shardSample{replicaSample("", "UNASSIGNED")}, t1)
+	assertPending(t, "unassigned again", pending, map[shardKey]pendingShard{
+		replicaKey(0): {state: "UNASSIGNED", node: unassignedNode, since: t1},
+	})
+}
+
+func TestTrackPendingAllocatesOneOfTwo(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := t0.Add(time.Minute)
+
+	pending := trackPending(nil, []shardSample{replicaSample("", "UNASSIGNED")}, t0)
+	pending = trackPending(pending, []shardSample{
+		replicaSample("", "UNASSIGNED"),
+		replicaSample("", "UNASSIGNED"),
+	}, t1)
+
+	// Whichever replica was allocated, neither copy loses its age nor takes
+	// a later one.
+	pending = trackPending(pending, []shardSample{
+		replicaSample("node-3", "INITIALIZING"),
+		replicaSample("", "UNASSIGNED"),
+	}, t0.Add(2*time.Minute))
+	assertPending(t, "one allocated", pending, map[shardKey]pendingShard{
+		replicaKey(0): {state: "UNASSIGNED", node: unassignedNode, since: t0},
+		replicaKey(1): {state: "INITIALIZING", node: "node-3", since: t1},
+	})
+}
+
+func TestTrackPendingPrefersUnassignedSlots(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := t0.Add(time.Minute)
+
+	pending := trackPending(nil, []shardSample{replicaSample("node-2", "INITIALIZING")}, t0)
+	pending = trackPending(pending, []shardSample{
+		replicaSample("node-2", "INITIALIZING"),
+		replicaSample("", "UNASSIGNED"),
+	}, t1)
+
+	// The copy on node-2 started and the unassigned one was allocated to
+	// node-3: the new INITIALIZING copy is the formerly unassigned one.
+	pending = trackPending(pending, []shardSample{
+		replicaSample("node-2", "STARTED"),
+		replicaSample("node-3", "INITIALIZING"),
+	}, t0.Add(2*time.Minute))
+	assertPending(t, "after allocation", pending, map[shardKey]pendingShard{
+		replicaKey(1): {state: "INITIALIZING", node: "node-3", since: t1},
+	})
+}
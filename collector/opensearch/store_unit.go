@@ -0,0 +1,35 @@
+package opensearch
+
+import "fmt"
+
+// StoreUnit is the unit store sizes are exported in.
+type StoreUnit string
+
+const (
+	StoreUnitBytes StoreUnit = "bytes"
+	StoreUnitKiB   StoreUnit = "KiB"
+	StoreUnitMiB   StoreUnit = "MiB"
+	StoreUnitGiB   StoreUnit = "GiB"
+)
+
+// divisor returns how many bytes make up one u.
+func (u StoreUnit) divisor() (float64, error) {
+	switch u {
+	case StoreUnitBytes:
+		return 1, nil
+	case StoreUnitKiB:
+		return 1 << 10, nil
+	case StoreUnitMiB:
+		return 1 << 20, nil
+	case StoreUnitGiB:
+		return 1 << 30, nil
+	default:
+		return 0, fmt.Errorf("unknown store unit %q", u)
+	}
+}
+
+// storeValue converts bytes to the configured StoreUnit.
+func (c *ShardCollector) storeValue(bytes float64) float64 {
+	d, _ := c.cfg.StoreUnit.divisor()
+	return bytes / d
+}
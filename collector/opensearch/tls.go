@@ -0,0 +1,76 @@
+package opensearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig describes how to verify a server and, optionally, which client
+// certificate to present.
+type TLSConfig struct {
+	// CAFile is a PEM encoded CA bundle used to verify the server
+	// certificate. Its CAs are added to the system pool, so servers with
+	// publicly trusted certificates still verify.
+	CAFile string
+	// CAFileOnly verifies servers against CAFile alone, starting from an
+	// empty pool instead of the system one.
+	CAFileOnly bool
+	// CertFile and KeyFile are a PEM encoded client certificate and key used
+	// for mutual TLS. Both must be set together.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name used to verify the server certificate.
+	ServerName string
+	// InsecureSkipVerify disables server certificate verification. Only use
+	// it for development.
+	InsecureSkipVerify bool
+}
+
+func (t TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := t.basePool()
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// basePool returns the pool CAFile is added to.
+func (t TLSConfig) basePool() (*x509.CertPool, error) {
+	if t.CAFileOnly {
+		return x509.NewCertPool(), nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load system CA pool: %w", err)
+	}
+	return pool, nil
+}
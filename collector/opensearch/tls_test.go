@@ -0,0 +1,102 @@
+package opensearch
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes data to a file in the test's temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSConfigCAPool(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	caFile := writeFile(t, "ca.pem", caPEM)
+
+	system, err := x509.SystemCertPool()
+	if err != nil {
+		t.Skipf("no system CA pool: %v", err)
+	}
+	system.AppendCertsFromPEM(caPEM)
+	only := x509.NewCertPool()
+	only.AppendCertsFromPEM(caPEM)
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		want *x509.CertPool
+	}{
+		{name: "system pool plus CA file", tls: TLSConfig{CAFile: caFile}, want: system},
+		{name: "CA file only", tls: TLSConfig{CAFile: caFile, CAFileOnly: true}, want: only},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.tls.build()
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if !cfg.RootCAs.Equal(tt.want) {
+				t.Error("root CAs differ from the expected pool")
+			}
+
+			c, err := newClient(srv.URL, Config{TLS: tt.tls}.withDefaults())
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			var v map[string]any
+			if err := c.getJSON(context.Background(), "_cluster/health", "", &v); err != nil {
+				t.Errorf("getJSON over TLS: %v", err)
+			}
+		})
+	}
+
+	// Without the CA the test server's certificate doesn't verify.
+	c, err := newClient(srv.URL, Config{}.withDefaults())
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	var v map[string]any
+	if err := c.getJSON(context.Background(), "_cluster/health", "", &v); err == nil {
+		t.Error("getJSON trusted an unknown CA")
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{name: "missing CA file", tls: TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: "failed to read CA file"},
+		{name: "CA file without certificates", tls: TLSConfig{CAFile: writeFile(t, "empty.pem", []byte("not a certificate"))}, wantErr: "no valid certificates found in CA file"},
+		{name: "certificate without key", tls: TLSConfig{CertFile: "client.pem"}, wantErr: "client certificate and key must be set together"},
+		{name: "key without certificate", tls: TLSConfig{KeyFile: "client.key"}, wantErr: "client certificate and key must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.tls.build()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("build error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package opensearch
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/credentials"
+)
+
+// tracerName is the instrumentation scope of the collector's spans.
+const tracerName = "opensearch.shards"
+
+// newTracerProvider returns the provider for scrape spans: provided if the
+// caller gave one, an OTLP exporting provider when Config.Tracing is set, and
+// a no-op provider otherwise. owned is non-nil when the collector created the
+// provider and must shut it down.
+func newTracerProvider(ctx context.Context, cfg Config, collectorEndpoint string, res *resource.Resource, provided trace.TracerProvider) (tp trace.TracerProvider, owned *sdktrace.TracerProvider, err error) {
+	if provided != nil {
+		return provided, nil, nil
+	}
+	if !cfg.Tracing {
+		return noop.NewTracerProvider(), nil, nil
+	}
+
+	if cfg.ExporterType != ExporterOTLP && cfg.ExporterType != ExporterOTLPHTTP {
+		return nil, nil, fmt.Errorf("tracing requires an OTLP exporter, got %q", cfg.ExporterType)
+	}
+	if err := validateHostPort(collectorEndpoint); err != nil {
+		return nil, nil, fmt.Errorf("invalid OTLP endpoint %q: %w", collectorEndpoint, err)
+	}
+	tlsConfig, err := otlpTLSConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	if cfg.ExporterType == ExporterOTLPHTTP {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(collectorEndpoint),
+			otlptracehttp.WithTimeout(cfg.OTLPTimeout),
+			otlptracehttp.WithHeaders(cfg.OTLPHeaders),
+		}
+		if tlsConfig == nil {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	} else {
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(collectorEndpoint),
+			otlptracegrpc.WithTimeout(cfg.OTLPTimeout),
+			otlptracegrpc.WithHeaders(cfg.OTLPHeaders),
+		}
+		if tlsConfig == nil {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if opt := cfg.OTLPKeepalive.dialOption(); opt != nil {
+			opts = append(opts, otlptracegrpc.WithDialOption(opt))
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	owned = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	return owned, owned, nil
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"instrumentation/collector/opensearch"
+)
+
+// agentConfig is the resolved configuration of the agent: the collector
+// settings plus the endpoints and process-level options main needs.
+type agentConfig struct {
+	OpenSearchEndpoint string
+	OTLPEndpoint       string
+	HealthListenAddr   string
+	LogLevel           slog.Level
+	// OTLPInsecure exports over plaintext, the agent's default. It is the
+	// inverse of Collector.OTLPSecure, which it sets once loading is done.
+	OTLPInsecure bool
+	// Once scrapes a single time, flushes and exits instead of looping.
+	Once bool
+	// PrintConfig prints the resolved configuration, with secrets redacted,
+	// and exits.
+	PrintConfig bool
+	Companions  companions
+	Collector   opensearch.Config
+}
+
+// companions selects the collectors run alongside the shard collector. Each
+// costs at least one more request per scrape, so all are off by default.
+type companions struct {
+	ClusterHealth bool
+	NodeStats     bool
+	IndexRates    bool
+	PendingTasks  bool
+}
+
+// companionFlags names the flag enabling each companion collector.
+var companionFlags = []struct {
+	name, usage string
+	field       func(*companions) *bool
+}{
+	{"cluster-health", "also collect _cluster/health", func(c *companions) *bool { return &c.ClusterHealth }},
+	{"node-stats", "also collect heap, disk and CPU from _nodes/stats", func(c *companions) *bool { return &c.NodeStats }},
+	{"index-rates", "also collect indexing and search rates from _stats", func(c *companions) *bool { return &c.IndexRates }},
+	{"pending-tasks", "also collect _cluster/pending_tasks", func(c *companions) *bool { return &c.PendingTasks }},
+}
+
+func defaultConfig() agentConfig {
+	return agentConfig{
+		OpenSearchEndpoint: "http://localhost:3000",
+		OTLPEndpoint:       "localhost:4317",
+		LogLevel:           slog.LevelInfo,
+		OTLPInsecure:       true,
+		Collector: opensearch.Config{
+			ScrapeInterval: opensearch.DefaultScrapeInterval,
+			ExportInterval: opensearch.DefaultExportInterval,
+			Indices:        []string{"otlp-metrics", "otlp-logs"},
+			MaxRetries:     3,
+			RequestTimeout: opensearch.DefaultRequestTimeout,
+		},
+	}
+}
+
+// loadConfig resolves the agent configuration. Later sources take
+// precedence: defaults, then the config file, then environment variables,
+// then command-line flags. Invalid flags are reported with the usage, and
+// --help returns flag.ErrHelp after printing it.
+func loadConfig(args []string, lookup func(string) (string, bool)) (agentConfig, error) {
+	cfg := defaultConfig()
+
+	// Flags are recorded as overrides while parsing and applied last, so only
+	// flags given explicitly take precedence over the file and environment.
+	var overrides []func(*agentConfig)
+	override := func(apply func(*agentConfig)) {
+		overrides = append(overrides, apply)
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configPath := fs.String("config", "", "`path` to a YAML or JSON config file")
+	printConfig := fs.Bool("print-config", false, "print the resolved configuration, with secrets redacted, and exit")
+	fs.Func("opensearch-endpoint", fmt.Sprintf("comma separated OpenSearch base `urls` (default %q)", cfg.OpenSearchEndpoint), func(v string) error {
+		override(func(c *agentConfig) { c.OpenSearchEndpoint = v })
+		return nil
+	})
+	fs.Func("otlp-endpoint", fmt.Sprintf("OTLP collector `host:port` (default %q)", cfg.OTLPEndpoint), func(v string) error {
+		override(func(c *agentConfig) { c.OTLPEndpoint = v })
+		return nil
+	})
+	fs.Func("scrape-interval", fmt.Sprintf("how often shards are fetched, as a `duration` such as 30s or 1m (default %s)", cfg.Collector.ScrapeInterval), func(v string) error {
+		d, err := parseDuration(v)
+		if err != nil {
+			return err
+		}
+		override(func(c *agentConfig) { c.Collector.ScrapeInterval = d })
+		return nil
+	})
+	fs.Func("indices", fmt.Sprintf("comma separated `indices` or patterns, empty for all (default %q)", strings.Join(cfg.Collector.Indices, ",")), func(v string) error {
+		override(func(c *agentConfig) { c.Collector.Indices = splitList(v) })
+		return nil
+	})
+	fs.Func("exporter", fmt.Sprintf("metric `exporter`: otlp, otlphttp, prometheus or stdout (default %q)", opensearch.ExporterOTLP), func(v string) error {
+		override(func(c *agentConfig) { c.Collector.ExporterType = opensearch.ExporterType(v) })
+		return nil
+	})
+	fs.BoolFunc("once", "scrape once, export and exit; the exit code is non-zero if the scrape failed", func(v string) error {
+		once, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		override(func(c *agentConfig) { c.Once = once })
+		return nil
+	})
+	for _, f := range companionFlags {
+		fs.BoolFunc(f.name, f.usage, func(v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			override(func(c *agentConfig) { *f.field(&c.Companions) = enabled })
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return agentConfig{}, err
+	}
+
+	if *configPath != "" {
+		if err := cfg.applyFile(*configPath); err != nil {
+			return agentConfig{}, err
+		}
+	}
+	if err := cfg.applyEnv(lookup); err != nil {
+		return agentConfig{}, err
+	}
+	for _, apply := range overrides {
+		apply(&cfg)
+	}
+	cfg.PrintConfig = *printConfig
+	cfg.Collector.OTLPSecure = !cfg.OTLPInsecure
+	// The agent keeps 0 for no request timeout; the library would treat it
+	// as unset.
+	if cfg.Collector.RequestTimeout == 0 {
+		cfg.Collector.RequestTimeout = opensearch.NoRequestTimeout
+	}
+
+	return cfg, nil
+}
+
+// applyEnv overrides cfg with the environment variables that are set.
+// Every invalid variable is reported, each error naming the variable.
+func (cfg *agentConfig) applyEnv(lookup func(string) (string, bool)) error {
+	env := envReader{lookup: lookup}
+	c := &cfg.Collector
+
+	env.string("OPENSEARCH_ENDPOINT", &cfg.OpenSearchEndpoint)
+	env.string("OTLP_ENDPOINT", &cfg.OTLPEndpoint)
+	env.bool("RUN_ONCE", &cfg.Once)
+	env.string("HEALTH_LISTEN_ADDR", &cfg.HealthListenAddr)
+	env.level("LOG_LEVEL", &cfg.LogLevel)
+	env.bool("CLUSTER_HEALTH_ENABLED", &cfg.Companions.ClusterHealth)
+	env.bool("NODE_STATS_ENABLED", &cfg.Companions.NodeStats)
+	env.bool("INDEX_RATES_ENABLED", &cfg.Companions.IndexRates)
+	env.bool("PENDING_TASKS_ENABLED", &cfg.Companions.PendingTasks)
+
+	env.duration("SCRAPE_INTERVAL", &c.ScrapeInterval)
+	env.duration("SCRAPE_TIMEOUT", &c.ScrapeTimeout)
+	env.timeout("SCRAPE_JITTER", &c.ScrapeJitter)
+	env.int("BREAKER_THRESHOLD", &c.BreakerThreshold)
+	env.duration("BREAKER_MAX_INTERVAL", &c.BreakerMaxInterval)
+	env.duration("EXPORT_INTERVAL", &c.ExportInterval)
+	env.duration("FLUSH_TIMEOUT", &c.FlushTimeout)
+	env.bool("FLUSH_AFTER_COLLECT", &c.FlushAfterCollect)
+	env.list("INDICES", &c.Indices)
+	env.list("ALIASES", &c.Aliases)
+	env.duration("ALIAS_REFRESH_INTERVAL", &c.AliasRefreshInterval)
+	env.bool("INCLUDE_HIDDEN_INDICES", &c.IncludeHidden)
+	env.string("INCLUDE_REGEX", &c.IncludeRegex)
+	env.string("EXCLUDE_REGEX", &c.ExcludeRegex)
+	env.list("INCLUDE_STATES", &c.IncludeStates)
+	env.list("NODES", &c.Nodes)
+	env.bool("LOCAL_NODE", &c.LocalNode)
+	env.list("EXCLUDE_STATES", &c.ExcludeStates)
+	env.list("OBSERVE_STATES", &c.ObserveStates)
+	env.string("ATTRIBUTE_MODE", (*string)(&c.AttributeMode))
+	env.string("STORE_UNIT", (*string)(&c.StoreUnit))
+	env.int64("MIN_STORE_BYTES", &c.MinStoreBytes)
+	env.string("SIZE_SOURCE", (*string)(&c.SizeSource))
+	env.bool("MEMORY_COLUMNS", &c.MemoryColumns)
+	env.bool("DOCS_STATS", &c.DocsStats)
+	env.bool("SEGMENTS_COUNT", &c.SegmentsCount)
+	env.bool("SHARDS_BY_ROLE", &c.ShardsByRole)
+	env.list("ENABLED_METRICS", &c.EnabledMetrics)
+	env.list("DISABLED_METRICS", &c.DisabledMetrics)
+	env.int("CONCURRENCY", &c.Concurrency)
+	env.int("MAX_RETRIES", &c.MaxRetries)
+	env.duration("RETRY_BASE_DELAY", &c.RetryBaseDelay)
+	env.bool("RAW_BYTES", &c.RawBytes)
+
+	env.string("OPENSEARCH_USERNAME", &c.Username)
+	env.string("OPENSEARCH_PASSWORD", &c.Password)
+	env.string("OPENSEARCH_API_KEY", &c.APIKey)
+	env.string("OPENSEARCH_BEARER_TOKEN", &c.BearerToken)
+	env.timeout("REQUEST_TIMEOUT", &c.RequestTimeout)
+	env.int64("MAX_RESPONSE_BYTES", &c.MaxResponseBytes)
+	env.string("OPENSEARCH_PROXY_URL", &c.ProxyURL)
+	env.mapping("OPENSEARCH_HEADERS", &c.Headers)
+	env.string("OPENSEARCH_USER_AGENT", &c.UserAgent)
+	env.string("OPENSEARCH_CA_FILE", &c.TLS.CAFile)
+	env.bool("OPENSEARCH_CA_FILE_ONLY", &c.TLS.CAFileOnly)
+	env.bool("OPENSEARCH_INSECURE_SKIP_VERIFY", &c.TLS.InsecureSkipVerify)
+
+	env.string("SERVICE_NAME", &c.ServiceName)
+	env.string("SERVICE_VERSION", &c.ServiceVersion)
+	env.mapping("RESOURCE_ATTRIBUTES", &c.ResourceAttributes)
+
+	env.exporterType("EXPORTER_TYPE", &c.ExporterType)
+	env.string("TEMPORALITY", (*string)(&c.Temporality))
+	env.bool("TRACING_ENABLED", &c.Tracing)
+	env.string("PROMETHEUS_LISTEN_ADDR", &c.PrometheusListenAddr)
+	env.bool("OTLP_INSECURE", &cfg.OTLPInsecure)
+	env.string("OTLP_CA_FILE", &c.OTLPTLS.CAFile)
+	env.bool("OTLP_CA_FILE_ONLY", &c.OTLPTLS.CAFileOnly)
+	env.string("OTLP_CERT_FILE", &c.OTLPTLS.CertFile)
+	env.string("OTLP_KEY_FILE", &c.OTLPTLS.KeyFile)
+	env.string("OTLP_SERVER_NAME", &c.OTLPTLS.ServerName)
+	env.mapping("OTLP_HEADERS", &c.OTLPHeaders)
+	env.duration("OTLP_TIMEOUT", &c.OTLPTimeout)
+	env.bool("OTLP_RETRY_DISABLED", &c.OTLPRetry.Disabled)
+	env.duration("OTLP_RETRY_INITIAL_INTERVAL", &c.OTLPRetry.InitialInterval)
+	env.duration("OTLP_RETRY_MAX_INTERVAL", &c.OTLPRetry.MaxInterval)
+	env.duration("OTLP_RETRY_MAX_ELAPSED_TIME", &c.OTLPRetry.MaxElapsedTime)
+	env.duration("OTLP_KEEPALIVE_TIME", &c.OTLPKeepalive.Time)
+	env.duration("OTLP_KEEPALIVE_TIMEOUT", &c.OTLPKeepalive.Timeout)
+
+	return errors.Join(env.errs...)
+}
+
+// envReader parses environment variables into typed fields, leaving a field
+// untouched when its variable is unset and collecting parse errors.
+type envReader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+func (r *envReader) fail(name, value string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("%s=%q: %w", name, value, err))
+}
+
+func (r *envReader) string(name string, dst *string) {
+	if v, ok := r.lookup(name); ok {
+		*dst = v
+	}
+}
+
+// list parses a comma separated list. An empty value yields an empty list.
+func (r *envReader) list(name string, dst *[]string) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	*dst = splitList(v)
+}
+
+// mapping parses comma separated key=value pairs.
+func (r *envReader) mapping(name string, dst *map[string]string) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	m := make(map[string]string)
+	for _, item := range splitList(v) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			r.fail(name, v, errors.New("must be comma separated key=value pairs"))
+			return
+		}
+		m[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	*dst = m
+}
+
+func (r *envReader) bool(name string, dst *bool) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		r.fail(name, v, errors.New("must be true or false"))
+		return
+	}
+	*dst = b
+}
+
+func (r *envReader) int(name string, dst *int) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		r.fail(name, v, errors.New("must be a non-negative integer"))
+		return
+	}
+	*dst = n
+}
+
+func (r *envReader) int64(name string, dst *int64) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		r.fail(name, v, errors.New("must be a non-negative integer"))
+		return
+	}
+	*dst = n
+}
+
+func (r *envReader) duration(name string, dst *time.Duration) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		r.fail(name, v, err)
+		return
+	}
+	*dst = d
+}
+
+func (r *envReader) level(name string, dst *slog.Level) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	if err := dst.UnmarshalText([]byte(v)); err != nil {
+		r.fail(name, v, errors.New("must be one of debug, info, warn or error"))
+	}
+}
+
+func (r *envReader) exporterType(name string, dst *opensearch.ExporterType) {
+	if v, ok := r.lookup(name); ok {
+		*dst = opensearch.ExporterType(v)
+	}
+}
+
+// timeout is like duration but also accepts 0, which disables the timeout.
+func (r *envReader) timeout(name string, dst *time.Duration) {
+	v, ok := r.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		r.fail(name, v, errors.New("must be a duration such as 30s, or 0 for none"))
+		return
+	}
+	*dst = d
+}
+
+// parseDuration parses a positive duration such as 30s or 1m.
+func parseDuration(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New("must be a duration such as 30s or 1m")
+	}
+	if d <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return d, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"instrumentation/collector/opensearch"
+)
+
+// fileConfig is the schema of the YAML or JSON config file. Every field is a
+// pointer so only the keys present in the file override the defaults.
+type fileConfig struct {
+	OpenSearch *fileOpenSearch `yaml:"opensearch"`
+	Scrape     *fileScrape     `yaml:"scrape"`
+	Export     *fileExport     `yaml:"export"`
+	Service    *fileService    `yaml:"service"`
+	Health     *fileListener   `yaml:"health"`
+	Log        *fileLog        `yaml:"log"`
+	Collectors *fileCollectors `yaml:"collectors"`
+}
+
+type fileCollectors struct {
+	ClusterHealth *bool `yaml:"cluster_health"`
+	NodeStats     *bool `yaml:"node_stats"`
+	IndexRates    *bool `yaml:"index_rates"`
+	PendingTasks  *bool `yaml:"pending_tasks"`
+}
+
+type fileOpenSearch struct {
+	Endpoint             *string                   `yaml:"endpoint"`
+	Username             *string                   `yaml:"username"`
+	Password             *string                   `yaml:"password"`
+	APIKey               *string                   `yaml:"api_key"`
+	BearerToken          *string                   `yaml:"bearer_token"`
+	Indices              *[]string                 `yaml:"indices"`
+	Aliases              *[]string                 `yaml:"aliases"`
+	AliasRefreshInterval *time.Duration            `yaml:"alias_refresh_interval"`
+	IncludeHidden        *bool                     `yaml:"include_hidden"`
+	IncludeRegex         *string                   `yaml:"include_regex"`
+	ExcludeRegex         *string                   `yaml:"exclude_regex"`
+	IncludeStates        *[]string                 `yaml:"include_states"`
+	Nodes                *[]string                 `yaml:"nodes"`
+	LocalNode            *bool                     `yaml:"local_node"`
+	ExcludeStates        *[]string                 `yaml:"exclude_states"`
+	ObserveStates        *[]string                 `yaml:"observe_states"`
+	AttributeMode        *opensearch.AttributeMode `yaml:"attribute_mode"`
+	StoreUnit            *opensearch.StoreUnit     `yaml:"store_unit"`
+	MinStoreBytes        *int64                    `yaml:"min_store_bytes"`
+	SizeSource           *opensearch.SizeSource    `yaml:"size_source"`
+	MemoryColumns        *bool                     `yaml:"memory_columns"`
+	DocsStats            *bool                     `yaml:"docs_stats"`
+	SegmentsCount        *bool                     `yaml:"segments_count"`
+	ShardsByRole         *bool                     `yaml:"shards_by_role"`
+	RawBytes             *bool                     `yaml:"raw_bytes"`
+	Concurrency          *int                      `yaml:"concurrency"`
+	MaxRetries           *int                      `yaml:"max_retries"`
+	RetryBaseDelay       *time.Duration            `yaml:"retry_base_delay"`
+	RequestTimeout       *time.Duration            `yaml:"request_timeout"`
+	MaxResponseBytes     *int64                    `yaml:"max_response_bytes"`
+	ProxyURL             *string                   `yaml:"proxy_url"`
+	Headers              *map[string]string        `yaml:"headers"`
+	UserAgent            *string                   `yaml:"user_agent"`
+	TLS                  *fileTLS                  `yaml:"tls"`
+}
+
+type fileScrape struct {
+	Interval           *time.Duration `yaml:"interval"`
+	Timeout            *time.Duration `yaml:"timeout"`
+	Jitter             *time.Duration `yaml:"jitter"`
+	BreakerThreshold   *int           `yaml:"breaker_threshold"`
+	BreakerMaxInterval *time.Duration `yaml:"breaker_max_interval"`
+}
+
+type fileExport struct {
+	Type              *opensearch.ExporterType `yaml:"type"`
+	Interval          *time.Duration           `yaml:"interval"`
+	FlushTimeout      *time.Duration           `yaml:"flush_timeout"`
+	FlushAfterCollect *bool                    `yaml:"flush_after_collect"`
+	Temporality       *opensearch.Temporality  `yaml:"temporality"`
+	EnabledMetrics    *[]string                `yaml:"enabled_metrics"`
+	DisabledMetrics   *[]string                `yaml:"disabled_metrics"`
+	Tracing           *bool                    `yaml:"tracing"`
+	OTLP              *fileOTLP                `yaml:"otlp"`
+	Prometheus        *fileListener            `yaml:"prometheus"`
+}
+
+type fileOTLP struct {
+	Endpoint  *string            `yaml:"endpoint"`
+	Insecure  *bool              `yaml:"insecure"`
+	TLS       *fileTLS           `yaml:"tls"`
+	Headers   *map[string]string `yaml:"headers"`
+	Timeout   *time.Duration     `yaml:"timeout"`
+	Retry     *fileRetry         `yaml:"retry"`
+	Keepalive *fileKeepalive     `yaml:"keepalive"`
+}
+
+type fileRetry struct {
+	Disabled        *bool          `yaml:"disabled"`
+	InitialInterval *time.Duration `yaml:"initial_interval"`
+	MaxInterval     *time.Duration `yaml:"max_interval"`
+	MaxElapsedTime  *time.Duration `yaml:"max_elapsed_time"`
+}
+
+type fileKeepalive struct {
+	Time    *time.Duration `yaml:"time"`
+	Timeout *time.Duration `yaml:"timeout"`
+}
+
+type fileService struct {
+	Name       *string            `yaml:"name"`
+	Version    *string            `yaml:"version"`
+	Attributes *map[string]string `yaml:"attributes"`
+}
+
+type fileListener struct {
+	ListenAddr *string `yaml:"listen_addr"`
+}
+
+type fileLog struct {
+	Level *slog.Level `yaml:"level"`
+}
+
+type fileTLS struct {
+	CAFile             *string `yaml:"ca_file"`
+	CAFileOnly         *bool   `yaml:"ca_file_only"`
+	CertFile           *string `yaml:"cert_file"`
+	KeyFile            *string `yaml:"key_file"`
+	ServerName         *string `yaml:"server_name"`
+	InsecureSkipVerify *bool   `yaml:"insecure_skip_verify"`
+}
+
+// applyFile overrides cfg with the settings in the config file at path.
+// Unknown keys are rejected so typos don't go unnoticed.
+func (cfg *agentConfig) applyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	var fc fileConfig
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if o := fc.Collectors; o != nil {
+		set(&cfg.Companions.ClusterHealth, o.ClusterHealth)
+		set(&cfg.Companions.NodeStats, o.NodeStats)
+		set(&cfg.Companions.IndexRates, o.IndexRates)
+		set(&cfg.Companions.PendingTasks, o.PendingTasks)
+	}
+
+	c := &cfg.Collector
+	if o := fc.OpenSearch; o != nil {
+		set(&cfg.OpenSearchEndpoint, o.Endpoint)
+		set(&c.Username, o.Username)
+		set(&c.Password, o.Password)
+		set(&c.APIKey, o.APIKey)
+		set(&c.BearerToken, o.BearerToken)
+		set(&c.Indices, o.Indices)
+		set(&c.Aliases, o.Aliases)
+		set(&c.AliasRefreshInterval, o.AliasRefreshInterval)
+		set(&c.IncludeHidden, o.IncludeHidden)
+		set(&c.IncludeRegex, o.IncludeRegex)
+		set(&c.ExcludeRegex, o.ExcludeRegex)
+		set(&c.IncludeStates, o.IncludeStates)
+		set(&c.Nodes, o.Nodes)
+		set(&c.LocalNode, o.LocalNode)
+		set(&c.ExcludeStates, o.ExcludeStates)
+		set(&c.ObserveStates, o.ObserveStates)
+		set(&c.AttributeMode, o.AttributeMode)
+		set(&c.StoreUnit, o.StoreUnit)
+		set(&c.MinStoreBytes, o.MinStoreBytes)
+		set(&c.SizeSource, o.SizeSource)
+		set(&c.MemoryColumns, o.MemoryColumns)
+		set(&c.DocsStats, o.DocsStats)
+		set(&c.SegmentsCount, o.SegmentsCount)
+		set(&c.ShardsByRole, o.ShardsByRole)
+		set(&c.RawBytes, o.RawBytes)
+		set(&c.Concurrency, o.Concurrency)
+		set(&c.MaxRetries, o.MaxRetries)
+		set(&c.RetryBaseDelay, o.RetryBaseDelay)
+		set(&c.RequestTimeout, o.RequestTimeout)
+		set(&c.MaxResponseBytes, o.MaxResponseBytes)
+		set(&c.ProxyURL, o.ProxyURL)
+		set(&c.Headers, o.Headers)
+		set(&c.UserAgent, o.UserAgent)
+		o.TLS.apply(&c.TLS)
+	}
+	if s := fc.Scrape; s != nil {
+		set(&c.ScrapeInterval, s.Interval)
+		set(&c.ScrapeTimeout, s.Timeout)
+		set(&c.ScrapeJitter, s.Jitter)
+		set(&c.BreakerThreshold, s.BreakerThreshold)
+		set(&c.BreakerMaxInterval, s.BreakerMaxInterval)
+	}
+	if e := fc.Export; e != nil {
+		set(&c.ExporterType, e.Type)
+		set(&c.ExportInterval, e.Interval)
+		set(&c.FlushTimeout, e.FlushTimeout)
+		set(&c.FlushAfterCollect, e.FlushAfterCollect)
+		set(&c.Temporality, e.Temporality)
+		set(&c.Tracing, e.Tracing)
+		set(&c.EnabledMetrics, e.EnabledMetrics)
+		set(&c.DisabledMetrics, e.DisabledMetrics)
+		if o := e.OTLP; o != nil {
+			set(&cfg.OTLPEndpoint, o.Endpoint)
+			set(&cfg.OTLPInsecure, o.Insecure)
+			o.TLS.apply(&c.OTLPTLS)
+			set(&c.OTLPHeaders, o.Headers)
+			set(&c.OTLPTimeout, o.Timeout)
+			if r := o.Retry; r != nil {
+				set(&c.OTLPRetry.Disabled, r.Disabled)
+				set(&c.OTLPRetry.InitialInterval, r.InitialInterval)
+				set(&c.OTLPRetry.MaxInterval, r.MaxInterval)
+				set(&c.OTLPRetry.MaxElapsedTime, r.MaxElapsedTime)
+			}
+			if k := o.Keepalive; k != nil {
+				set(&c.OTLPKeepalive.Time, k.Time)
+				set(&c.OTLPKeepalive.Timeout, k.Timeout)
+			}
+		}
+		if p := e.Prometheus; p != nil {
+			set(&c.PrometheusListenAddr, p.ListenAddr)
+		}
+	}
+	if sv := fc.Service; sv != nil {
+		set(&c.ServiceName, sv.Name)
+		set(&c.ServiceVersion, sv.Version)
+		set(&c.ResourceAttributes, sv.Attributes)
+	}
+	if h := fc.Health; h != nil {
+		set(&cfg.HealthListenAddr, h.ListenAddr)
+	}
+	if l := fc.Log; l != nil {
+		set(&cfg.LogLevel, l.Level)
+	}
+
+	return nil
+}
+
+func (t *fileTLS) apply(dst *opensearch.TLSConfig) {
+	if t == nil {
+		return
+	}
+	set(&dst.CAFile, t.CAFile)
+	set(&dst.CAFileOnly, t.CAFileOnly)
+	set(&dst.CertFile, t.CertFile)
+	set(&dst.KeyFile, t.KeyFile)
+	set(&dst.ServerName, t.ServerName)
+	set(&dst.InsecureSkipVerify, t.InsecureSkipVerify)
+}
+
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
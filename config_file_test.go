@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+	}{
+		{
+			name: "YAML",
+			file: "agent.yaml",
+			content: `
+opensearch:
+  endpoint: https://search:9200
+  username: agent
+  indices: [logs-*, metrics]
+scrape:
+  interval: 45s
+export:
+  otlp:
+    endpoint: collector:4317
+    keepalive:
+      time: 30s
+      timeout: 5s
+`,
+		},
+		{
+			name: "JSON",
+			file: "agent.json",
+			content: `{
+  "opensearch": {"endpoint": "https://search:9200", "username": "agent", "indices": ["logs-*", "metrics"]},
+  "scrape": {"interval": "45s"},
+  "export": {"otlp": {"endpoint": "collector:4317", "keepalive": {"time": "30s", "timeout": "5s"}}}
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file, tt.content)
+			cfg, err := loadConfig([]string{"--config", path}, env(nil))
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if cfg.OpenSearchEndpoint != "https://search:9200" {
+				t.Errorf("OpenSearchEndpoint = %q", cfg.OpenSearchEndpoint)
+			}
+			if cfg.OTLPEndpoint != "collector:4317" {
+				t.Errorf("OTLPEndpoint = %q", cfg.OTLPEndpoint)
+			}
+			if cfg.Collector.Username != "agent" {
+				t.Errorf("Username = %q", cfg.Collector.Username)
+			}
+			if want := []string{"logs-*", "metrics"}; !slices.Equal(cfg.Collector.Indices, want) {
+				t.Errorf("Indices = %q, want %q", cfg.Collector.Indices, want)
+			}
+			if cfg.Collector.ScrapeInterval != 45*time.Second {
+				t.Errorf("ScrapeInterval = %v, want 45s", cfg.Collector.ScrapeInterval)
+			}
+			if k := cfg.Collector.OTLPKeepalive; k.Time != 30*time.Second || k.Timeout != 5*time.Second {
+				t.Errorf("OTLPKeepalive = %+v, want 30s and 5s", k)
+			}
+			// Keys missing from the file keep their defaults.
+			if cfg.Collector.MaxRetries != defaultConfig().Collector.MaxRetries {
+				t.Errorf("MaxRetries = %d, want the default", cfg.Collector.MaxRetries)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "agent.yaml", `
+opensearch:
+  endpoint: https://from-file:9200
+  indices: [from-file]
+scrape:
+  interval: 10s
+export:
+  otlp:
+    endpoint: from-file:4317
+`)
+	tests := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		wantEndpoint string
+		wantIndices  []string
+		wantInterval time.Duration
+		wantOTLP     string
+	}{
+		{
+			name:         "file over defaults",
+			wantEndpoint: "https://from-file:9200",
+			wantIndices:  []string{"from-file"},
+			wantInterval: 10 * time.Second,
+			wantOTLP:     "from-file:4317",
+		},
+		{
+			name:         "environment over file",
+			env:          map[string]string{"OPENSEARCH_ENDPOINT": "https://from-env:9200", "SCRAPE_INTERVAL": "20s"},
+			wantEndpoint: "https://from-env:9200",
+			wantIndices:  []string{"from-file"},
+			wantInterval: 20 * time.Second,
+			wantOTLP:     "from-file:4317",
+		},
+		{
+			name:         "flags over environment",
+			args:         []string{"--opensearch-endpoint", "https://from-flag:9200", "--indices", "from-flag"},
+			env:          map[string]string{"OPENSEARCH_ENDPOINT": "https://from-env:9200", "INDICES": "from-env", "SCRAPE_INTERVAL": "20s"},
+			wantEndpoint: "https://from-flag:9200",
+			wantIndices:  []string{"from-flag"},
+			wantInterval: 20 * time.Second,
+			wantOTLP:     "from-file:4317",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(append([]string{"--config", path}, tt.args...), env(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if cfg.OpenSearchEndpoint != tt.wantEndpoint {
+				t.Errorf("OpenSearchEndpoint = %q, want %q", cfg.OpenSearchEndpoint, tt.wantEndpoint)
+			}
+			if !slices.Equal(cfg.Collector.Indices, tt.wantIndices) {
+				t.Errorf("Indices = %q, want %q", cfg.Collector.Indices, tt.wantIndices)
+			}
+			if cfg.Collector.ScrapeInterval != tt.wantInterval {
+				t.Errorf("ScrapeInterval = %v, want %v", cfg.Collector.ScrapeInterval, tt.wantInterval)
+			}
+			if cfg.OTLPEndpoint != tt.wantOTLP {
+				t.Errorf("OTLPEndpoint = %q, want %q", cfg.OTLPEndpoint, tt.wantOTLP)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			path:    writeConfigFile(t, "typo.yaml", "opensearch:\n  endpoit: https://search:9200\n"),
+			wantErr: "field endpoit not found",
+		},
+		{
+			name:    "unknown section",
+			path:    writeConfigFile(t, "section.yaml", "scrapes:\n  interval: 10s\n"),
+			wantErr: "field scrapes not found",
+		},
+		{
+			name:    "wrong type",
+			path:    writeConfigFile(t, "type.yaml", "opensearch:\n  indices: logs\n"),
+			wantErr: "invalid config file",
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(t.TempDir(), "missing.yaml"),
+			wantErr: "failed to open config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig([]string{"--config", tt.path}, env(nil))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadConfig error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEmptyFile(t *testing.T) {
+	path := writeConfigFile(t, "empty.yaml", "")
+	cfg, err := loadConfig([]string{"--config", path}, env(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.OpenSearchEndpoint != defaultConfig().OpenSearchEndpoint {
+		t.Errorf("OpenSearchEndpoint = %q, want the default", cfg.OpenSearchEndpoint)
+	}
+}
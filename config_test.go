@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"instrumentation/collector/opensearch"
+)
+
+// env returns a lookup function for loadConfig that sees only vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	cfg, err := loadConfig(nil, env(map[string]string{
+		"OPENSEARCH_ENDPOINT": "https://search-1:9200,https://search-2:9200",
+		"OTLP_ENDPOINT":       "collector:4317",
+		"SCRAPE_INTERVAL":     "15s",
+		"INDICES":             " logs-* , metrics ,",
+		"OPENSEARCH_USERNAME": "agent",
+		"OPENSEARCH_PASSWORD": "s3cret",
+		"OPENSEARCH_HEADERS":  "securitytenant=global, x-team = search",
+		"MAX_RETRIES":         "5",
+		"REQUEST_TIMEOUT":     "0",
+		"LOG_LEVEL":           "debug",
+		"OTLP_INSECURE":       "false",
+		"DOCS_STATS":          "true",
+		"OTLP_KEEPALIVE_TIME": "30s",
+	}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	if cfg.OpenSearchEndpoint != "https://search-1:9200,https://search-2:9200" {
+		t.Errorf("OpenSearchEndpoint = %q", cfg.OpenSearchEndpoint)
+	}
+	if cfg.OTLPEndpoint != "collector:4317" {
+		t.Errorf("OTLPEndpoint = %q", cfg.OTLPEndpoint)
+	}
+	c := cfg.Collector
+	if c.ScrapeInterval != 15*time.Second {
+		t.Errorf("ScrapeInterval = %v, want 15s", c.ScrapeInterval)
+	}
+	if want := []string{"logs-*", "metrics"}; !slices.Equal(c.Indices, want) {
+		t.Errorf("Indices = %q, want %q", c.Indices, want)
+	}
+	if c.Username != "agent" || c.Password != "s3cret" {
+		t.Errorf("credentials = %q/%q, want agent/s3cret", c.Username, c.Password)
+	}
+	if c.Headers["securitytenant"] != "global" || c.Headers["x-team"] != "search" || len(c.Headers) != 2 {
+		t.Errorf("Headers = %v", c.Headers)
+	}
+	if c.MaxRetries != 5 {
+		t.Errorf("MaxRetries = %d, want 5", c.MaxRetries)
+	}
+	// 0 disables the timeout rather than selecting the library default.
+	if c.RequestTimeout != opensearch.NoRequestTimeout {
+		t.Errorf("RequestTimeout = %v, want NoRequestTimeout", c.RequestTimeout)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("LogLevel = %v, want debug", cfg.LogLevel)
+	}
+	if !c.OTLPSecure {
+		t.Error("OTLPSecure is false with OTLP_INSECURE=false")
+	}
+	if !c.DocsStats {
+		t.Error("DocsStats is false with DOCS_STATS=true")
+	}
+	if c.OTLPKeepalive.Time != 30*time.Second || c.OTLPKeepalive.Timeout != 0 {
+		t.Errorf("OTLPKeepalive = %+v, want a 30s time and the default timeout", c.OTLPKeepalive)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig(nil, env(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	want := defaultConfig()
+	if cfg.OpenSearchEndpoint != want.OpenSearchEndpoint || cfg.OTLPEndpoint != want.OTLPEndpoint {
+		t.Errorf("endpoints = %q, %q, want %q, %q", cfg.OpenSearchEndpoint, cfg.OTLPEndpoint, want.OpenSearchEndpoint, want.OTLPEndpoint)
+	}
+	if !slices.Equal(cfg.Collector.Indices, want.Collector.Indices) {
+		t.Errorf("Indices = %q, want %q", cfg.Collector.Indices, want.Collector.Indices)
+	}
+	if cfg.Collector.OTLPSecure {
+		t.Error("OTLPSecure is true by default, want plaintext")
+	}
+}
+
+func TestLoadConfigEnvErrors(t *testing.T) {
+	_, err := loadConfig(nil, env(map[string]string{
+		"SCRAPE_INTERVAL":    "soon",
+		"EXPORT_INTERVAL":    "-1s",
+		"MAX_RETRIES":        "-1",
+		"DOCS_STATS":         "yes please",
+		"LOG_LEVEL":          "loud",
+		"OPENSEARCH_HEADERS": "securitytenant",
+		"REQUEST_TIMEOUT":    "forever",
+		"SCRAPE_TIMEOUT":     "10s",
+	}))
+	if err == nil {
+		t.Fatal("loadConfig succeeded, want an error")
+	}
+
+	// Every invalid variable is reported, by name, in one error.
+	for _, want := range []string{
+		`SCRAPE_INTERVAL="soon": must be a duration such as 30s or 1m`,
+		`EXPORT_INTERVAL="-1s": must be positive`,
+		`MAX_RETRIES="-1": must be a non-negative integer`,
+		`DOCS_STATS="yes please": must be true or false`,
+		`LOG_LEVEL="loud": must be one of debug, info, warn or error`,
+		`OPENSEARCH_HEADERS="securitytenant": must be comma separated key=value pairs`,
+		`REQUEST_TIMEOUT="forever": must be a duration such as 30s, or 0 for none`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "SCRAPE_TIMEOUT") {
+		t.Errorf("error %q names the valid SCRAPE_TIMEOUT", err)
+	}
+}
+
+func TestLoadConfigFlags(t *testing.T) {
+	cfg, err := loadConfig([]string{
+		"--opensearch-endpoint", "https://search:9200",
+		"--otlp-endpoint=collector:4317",
+		"--scrape-interval", "2m",
+		"--indices", "logs-*,metrics",
+		"--exporter", "prometheus",
+		"--once",
+		"--node-stats",
+		"--print-config",
+	}, env(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.OpenSearchEndpoint != "https://search:9200" || cfg.OTLPEndpoint != "collector:4317" {
+		t.Errorf("endpoints = %q, %q", cfg.OpenSearchEndpoint, cfg.OTLPEndpoint)
+	}
+	if cfg.Collector.ScrapeInterval != 2*time.Minute {
+		t.Errorf("ScrapeInterval = %v, want 2m", cfg.Collector.ScrapeInterval)
+	}
+	if want := []string{"logs-*", "metrics"}; !slices.Equal(cfg.Collector.Indices, want) {
+		t.Errorf("Indices = %q, want %q", cfg.Collector.Indices, want)
+	}
+	if cfg.Collector.ExporterType != opensearch.ExporterPrometheus {
+		t.Errorf("ExporterType = %q, want prometheus", cfg.Collector.ExporterType)
+	}
+	if !cfg.Once || !cfg.Companions.NodeStats || cfg.Companions.ClusterHealth || !cfg.PrintConfig {
+		t.Errorf("Once = %t, Companions = %+v, PrintConfig = %t", cfg.Once, cfg.Companions, cfg.PrintConfig)
+	}
+
+	// An empty --indices scrapes every index.
+	cfg, err = loadConfig([]string{"--indices", ""}, env(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.Collector.Indices) != 0 {
+		t.Errorf("Indices = %q, want none", cfg.Collector.Indices)
+	}
+}
+
+func TestLoadConfigFlagErrors(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{
+			args:    []string{"--scrape-interval", "soon"},
+			wantErr: `invalid value "soon" for flag -scrape-interval: must be a duration such as 30s or 1m`,
+		},
+		{
+			args:    []string{"--scrape-interval=0s"},
+			wantErr: `invalid value "0s" for flag -scrape-interval: must be positive`,
+		},
+		{args: []string{"--once=maybe"}, wantErr: `invalid boolean value "maybe" for -once`},
+		{args: []string{"--opensearch"}, wantErr: "flag provided but not defined: -opensearch"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			_, err := loadConfig(tt.args, env(nil))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadConfig error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHelp(t *testing.T) {
+	if _, err := loadConfig([]string{"--help"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("loadConfig(--help) error = %v, want flag.ErrHelp", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"instrumentation/collector/opensearch"
+)
+
+// readyIntervals is how many scrape intervals may pass since the last
+// successful scrape before the agent reports itself as not ready.
+const readyIntervals = 3
+
+// serveHealth serves /healthz, which always succeeds while the process is
+// running, and /readyz, which succeeds only if the most recent scrape
+// succeeded within readyIntervals scrape intervals.
+func serveHealth(addr string, collector *opensearch.ShardCollector, logger *slog.Logger) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{Handler: healthHandler(collector)}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Health endpoint stopped", "error", err)
+		}
+	}()
+
+	return srv, nil
+}
+
+// healthHandler serves /healthz and /readyz for collector. Scrape ages are
+// judged by the collector's own clock.
+func healthHandler(collector *opensearch.ShardCollector) http.Handler {
+	maxAge := readyIntervals * collector.ScrapeInterval()
+	clock := collector.Clock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		lastSuccess, err := collector.LastScrape()
+		switch {
+		case err != nil:
+			http.Error(w, fmt.Sprintf("last scrape failed: %v", err), http.StatusServiceUnavailable)
+		case lastSuccess.IsZero():
+			http.Error(w, "no successful scrape yet", http.StatusServiceUnavailable)
+		case clock.Now().Sub(lastSuccess) > maxAge:
+			http.Error(w, fmt.Sprintf("last successful scrape was at %s", lastSuccess.Format(time.RFC3339)), http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, "ok")
+		}
+	})
+	return mux
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"instrumentation/collector/opensearch"
+	"instrumentation/collector/opensearch/opensearchtest"
+)
+
+func TestHealthHandler(t *testing.T) {
+	srv := opensearchtest.NewServer()
+	defer srv.Close()
+	srv.SetShards("logs", opensearch.ShardInfo{Shard: "0", Prirep: "p", State: "STARTED", Docs: "1", Store: "1kb", Node: "node-1"})
+	clock := opensearchtest.NewClock(time.Unix(1_700_000_000, 0))
+
+	collector, err := opensearch.NewShardCollector(context.Background(),
+		opensearch.WithOpenSearchEndpoint(srv.URL),
+		opensearch.WithReader(sdkmetric.NewManualReader()),
+		opensearch.WithIndices("logs"),
+		opensearch.WithScrapeInterval(time.Minute),
+		opensearch.WithClock(clock),
+	)
+	if err != nil {
+		t.Fatalf("NewShardCollector: %v", err)
+	}
+	defer collector.Shutdown(context.Background())
+	handler := healthHandler(collector)
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+	expect := func(step, path string, wantCode int, wantBody string) {
+		t.Helper()
+		code, body := get(path)
+		if code != wantCode || !strings.Contains(body, wantBody) {
+			t.Errorf("%s: %s = %d %q, want %d containing %q", step, path, code, body, wantCode, wantBody)
+		}
+	}
+	scrape := func() {
+		t.Helper()
+		_, _ = collector.CollectOnce(context.Background())
+	}
+
+	expect("before the first scrape", "/healthz", http.StatusOK, "ok")
+	expect("before the first scrape", "/readyz", http.StatusServiceUnavailable, "no successful scrape yet")
+
+	scrape()
+	expect("after a scrape", "/readyz", http.StatusOK, "ok")
+
+	// Ready for up to three scrape intervals after the last success.
+	clock.Advance(3 * time.Minute)
+	expect("three intervals later", "/readyz", http.StatusOK, "ok")
+	clock.Advance(time.Second)
+	expect("past three intervals", "/readyz", http.StatusServiceUnavailable, "last successful scrape was at")
+
+	scrape()
+	expect("after recovering", "/readyz", http.StatusOK, "ok")
+
+	srv.SetResponse("/_cat/shards/logs", http.StatusInternalServerError, `{"error":"boom"}`)
+	scrape()
+	expect("after a failed scrape", "/readyz", http.StatusServiceUnavailable, "last scrape failed")
+	expect("after a failed scrape", "/healthz", http.StatusOK, "ok")
+}
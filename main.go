@@ -2,36 +2,130 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"go.opentelemetry.io/otel"
+
 	"instrumentation/collector/opensearch"
 )
 
+// shutdownTimeout bounds how long the health endpoint may take to stop. The
+// collectors bound their own final flush.
+const shutdownTimeout = 5 * time.Second
+
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal(slog.Default(), "Invalid configuration", err)
+	}
+	if cfg.PrintConfig {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			fatal(slog.Default(), "Failed to print configuration", err)
+		}
+		return
+	}
 
-	collector, err := opensearch.NewShardCollector(
-		ctx,
-		"http://localhost:3000",
-		"localhost:4317",
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	slog.SetDefault(logger)
+	cfg.Collector.Logger = logger
+
+	collector, err := opensearch.NewShardCollector(ctx,
+		opensearch.WithConfig(cfg.Collector),
+		opensearch.WithOpenSearchEndpoint(cfg.OpenSearchEndpoint),
+		opensearch.WithOTLPEndpoint(cfg.OTLPEndpoint),
 	)
 	if err != nil {
-		log.Fatalf("Failed to create collector: %v", err)
+		fatal(logger, "Failed to create collector", err)
+	}
+	otel.SetErrorHandler(collector)
+	runner, err := opensearch.NewRunner(collector)
+	if err != nil {
+		fatal(logger, "Failed to create runner", err)
+	}
+
+	if cfg.Companions.ClusterHealth {
+		health, err := opensearch.NewClusterHealthCollector(cfg.OpenSearchEndpoint, runner.MeterProvider(), cfg.Collector)
+		if err != nil {
+			fatal(logger, "Failed to create cluster health collector", err)
+		}
+		runner.Add(health)
+	}
+	if cfg.Companions.NodeStats {
+		nodes, err := opensearch.NewNodeStatsCollector(cfg.OpenSearchEndpoint, runner.MeterProvider(), cfg.Collector)
+		if err != nil {
+			fatal(logger, "Failed to create node stats collector", err)
+		}
+		runner.Add(nodes)
+	}
+	if cfg.Companions.IndexRates {
+		rates, err := opensearch.NewIndexRateCollector(cfg.OpenSearchEndpoint, runner.MeterProvider(), cfg.Collector)
+		if err != nil {
+			fatal(logger, "Failed to create index rate collector", err)
+		}
+		runner.Add(rates)
+	}
+	if cfg.Companions.PendingTasks {
+		pending, err := opensearch.NewPendingTasksCollector(cfg.OpenSearchEndpoint, runner.MeterProvider(), cfg.Collector)
+		if err != nil {
+			fatal(logger, "Failed to create pending tasks collector", err)
+		}
+		runner.Add(pending)
 	}
-	defer collector.Shutdown(ctx)
 
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+	// The health endpoint is disabled unless a listen address is given.
+	var healthServer *http.Server
+	if cfg.HealthListenAddr != "" {
+		healthServer, err = serveHealth(cfg.HealthListenAddr, collector, logger)
+		if err != nil {
+			fatal(logger, "Failed to start health endpoint", err)
+		}
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			if err := collector.CollectMetrics(ctx); err != nil {
-				log.Printf("Failed to collect metrics: %v", err)
-			}
+	failed := false
+	if cfg.Once {
+		failed = runner.Collect(ctx) != nil
+		// Push right away rather than relying on the export interval, so
+		// the run's data is out even if shutdown is cut short.
+		if err := runner.Flush(ctx); err != nil {
+			logger.Error("Failed to flush metrics", "error", err)
+			failed = true
 		}
+	} else {
+		runner.Run(ctx)
 	}
+
+	logger.Info("Shutting down")
+	if healthServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := healthServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to shut down health endpoint", "error", err)
+		}
+	}
+	if err := runner.Shutdown(context.Background()); err != nil {
+		logger.Error("Failed to shut down collectors", "error", err)
+		failed = failed || cfg.Once
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
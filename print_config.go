@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// redacted replaces the values of secret settings in printed output.
+const redacted = "<redacted>"
+
+// secretFields name the settings whose values printConfig never shows.
+var secretFields = map[string]bool{
+	"Username":    true,
+	"Password":    true,
+	"APIKey":      true,
+	"BearerToken": true,
+}
+
+// secretMaps name the map settings whose keys are shown but whose values
+// are redacted, as they may carry credentials.
+var secretMaps = map[string]bool{
+	"Headers":     true,
+	"OTLPHeaders": true,
+}
+
+// omittedFields aren't settings and are left out.
+var omittedFields = map[string]bool{
+	"Logger":      true,
+	"Clock":       true,
+	"PrintConfig": true,
+}
+
+// printConfig writes cfg as one name=value line per setting, with nested
+// settings named by their path, such as Collector.ScrapeInterval=1m0s.
+func printConfig(w io.Writer, cfg agentConfig) error {
+	cfg.Collector = cfg.Collector.WithDefaults()
+	if u, err := url.Parse(cfg.Collector.ProxyURL); err == nil {
+		// Keep the proxy visible but not its password.
+		cfg.Collector.ProxyURL = u.Redacted()
+	}
+
+	var lines []string
+	appendFields(&lines, "", reflect.ValueOf(cfg))
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+func appendFields(lines *[]string, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if !field.IsExported() || omittedFields[field.Name] {
+			continue
+		}
+		name := prefix + field.Name
+		switch {
+		case secretFields[field.Name]:
+			*lines = append(*lines, name+"="+redact(value))
+		case value.Kind() == reflect.Struct:
+			appendFields(lines, name+".", value)
+		default:
+			*lines = append(*lines, name+"="+formatValue(value, secretMaps[field.Name]))
+		}
+	}
+}
+
+func redact(v reflect.Value) string {
+	if v.IsZero() {
+		return ""
+	}
+	return redacted
+}
+
+func formatValue(v reflect.Value, redactValues bool) string {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Func:
+		if v.IsNil() {
+			return ""
+		}
+		return "<set>"
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			value := fmt.Sprint(v.MapIndex(key).Interface())
+			if redactValues {
+				value = redacted
+			}
+			pairs = append(pairs, fmt.Sprintf("%v=%s", key.Interface(), value))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}